@@ -64,6 +64,17 @@ type (
 		// between synth.Renders.
 		Release(voice int)
 
+		// SetParameter sets the value of the parameter targeted by an
+		// automation lane, writing it directly to the compiled patch. The value
+		// lasts until the next Update. Called between synth.Renders.
+		SetParameter(target AutomationTarget, value int)
+
+		// SetSongTime sets the position of the song, in samples from its
+		// start. The tempo-synced units, e.g. ramp and random, derive their
+		// phase from it, so it should be set when the playing jumps to another
+		// position in the song. Called between synth.Renders.
+		SetSongTime(time int)
+
 		// Close disposes the synth, freeing any resources. No other functions should be called after Close.
 		Close()
 
@@ -78,13 +89,16 @@ type (
 		Name() string // Name of the synther, e.g. "Go" or "Native"
 		Synth(patch Patch, bpm int) (Synth, error)
 		SupportsMultithreading() bool
+		SupportsOversampling() bool // whether Instrument.Oversampling is honored
 	}
 
 	CPULoad float32
 )
 
 // Play plays the Song by first compiling the patch with the given Synther,
-// returning the stereo audio buffer as a result (and possible errors).
+// returning the stereo audio buffer as a result (and possible errors). When
+// the automation lanes change their values, their parameters are written to
+// the synth at the start of the row.
 func Play(synther Synther, song Song, progress func(float32)) (AudioBuffer, error) {
 	err := song.Validate()
 	if err != nil {
@@ -99,12 +113,14 @@ func Play(synther Synther, song Song, progress func(float32)) (AudioBuffer, erro
 	for i := range curVoices {
 		curVoices[i] = song.Score.FirstVoiceForTrack(i)
 	}
+	laneValues := make([]byte, len(song.Score.Tracks))
 	initialCapacity := song.Score.LengthInRows() * song.SamplesPerRow()
 	buffer := make(AudioBuffer, 0, initialCapacity)
 	rowbuffer := make(AudioBuffer, song.SamplesPerRow())
 	for row := 0; row < song.Score.LengthInRows(); row++ {
 		patternRow := row % song.Score.RowsPerPattern
 		pattern := row / song.Score.RowsPerPattern
+		lanesChanged := false
 		for t := range song.Score.Tracks {
 			order := song.Score.Tracks[t].Order
 			if pattern < 0 || pattern >= len(order) {
@@ -123,6 +139,11 @@ func Play(synther Synther, song Song, progress func(float32)) (AudioBuffer, erro
 			if note > 0 && note <= 1 { // anything but hold causes an action.
 				continue
 			}
+			if song.Score.Tracks[t].IsAutomation() {
+				lanesChanged = lanesChanged || laneValues[t] != note
+				laneValues[t] = note
+				continue
+			}
 			synth.Release(curVoices[t])
 			if note > 1 {
 				curVoices[t]++
@@ -133,6 +154,9 @@ func Play(synther Synther, song Song, progress func(float32)) (AudioBuffer, erro
 				synth.Trigger(curVoices[t], note)
 			}
 		}
+		if lanesChanged {
+			song.SetLanes(synth, laneValues)
+		}
 		tries := 0
 		for rowtime := 0; rowtime < song.SamplesPerRow(); {
 			samples, time, err := synth.Render(rowbuffer, song.SamplesPerRow()-rowtime)
@@ -45,6 +45,9 @@ func main() {
 	output16bit := flag.Bool("i", false, "Compiled song should output 16-bit integers, instead of floats.")
 	targetOs := flag.String("os", runtime.GOOS, "Target OS. Defaults to current OS. Possible values: windows, darwin, linux. Anything else is assumed linuxy. Ignored when targeting wasm.")
 	versionFlag := flag.Bool("v", false, "Print version.")
+	optimize := flag.Bool("O", false, "Optimize the patch before compiling: remove disabled units, muted and silent instruments, trailing tracks that never play a note and unreferenced IDs, and fold constants. Prints what was removed.")
+	transpose := flag.Bool("transpose", false, "Store patterns that are transposed versions of each other only once, with a transpose for each pattern in the order list.")
+	stats := flag.Bool("stats", false, "Print a size report of the song: which units need each opcode, the sizes of the data tables and their estimated compressed sizes.")
 	flag.Usage = printUsage
 	flag.Parse()
 	if *versionFlag {
@@ -68,6 +71,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, `error creating compiler: %v`, err)
 			os.Exit(1)
 		}
+		comp.TransposePatterns = *transpose
 	}
 	output := func(filename string, extension string, contents []byte) error {
 		if *stdout {
@@ -140,6 +144,31 @@ func main() {
 		if song.Score.Length == 0 {
 			song.Score.Length = len(song.Score.Tracks[0].Patterns)
 		}
+		if *optimize {
+			var report []string
+			song, report = compiler.Optimize(&song)
+			w := os.Stdout
+			if *stdout {
+				w = os.Stderr
+			}
+			for _, line := range report {
+				fmt.Fprintf(w, "%v: %v\n", filename, line)
+			}
+		}
+		if *stats {
+			report, err := compiler.NewStats(&song)
+			if err != nil {
+				return fmt.Errorf("computing stats failed: %v", err)
+			}
+			w := os.Stdout
+			if *stdout {
+				w = os.Stderr // keep the report separate from the compiled code
+			}
+			fmt.Fprintf(w, "%v:\n", filename)
+			if err := report.Write(w); err != nil {
+				return fmt.Errorf("could not write stats: %v", err)
+			}
+		}
 		var compiledPlayer map[string]string
 		if compile {
 			var err error
@@ -26,7 +26,13 @@ type (
 		// ThreadMaskM1 is a bit mask of which threads are used, minus 1. Minus
 		// 1 is done so that the default value 0 means bit mask 0b0001 i.e. only
 		// thread 1 is rendering the instrument.
-		ThreadMaskM1 int    `yaml:",omitempty"`
+		ThreadMaskM1 int `yaml:",omitempty"`
+		// Oversampling is the number of times the instrument is processed per
+		// sample, to reduce aliasing in distortion, crush and resonant
+		// filters. 0 and 1 mean no oversampling; 2 and 4 are the only
+		// supported factors. Only the Go synth supports oversampling:
+		// compiling a song with an oversampled instrument into a player fails.
+		Oversampling int    `yaml:",omitempty"`
 		MIDI         MIDI   `yaml:",flow,omitempty"` // MIDI contains info on how MIDI events should trigger this instrument.
 		Units        []Unit // Units contains all the units of the instrument
 	}
@@ -55,7 +61,8 @@ type (
 		// VarArgs is a list containing the variable number arguments that some
 		// units require, most notably the DELAY units. For example, for a DELAY
 		// unit, VarArgs is the delaytimes, in samples, of the different delaylines
-		// in the unit.
+		// in the unit. For a WAVETABLE unit, VarArgs is the samples of its
+		// frames.
 		VarArgs []int `yaml:",flow,omitempty"`
 
 		// Disabled is a flag that can be set to true to disable the unit.
@@ -177,6 +184,36 @@ var UnitTypes = map[string]UnitType{
 		Params:   []UnitParameter{{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false}},
 		StackUse: stackUseSource,
 	},
+	"ladder": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "frequency", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				freq := float64(v) / 128
+				return strconv.FormatFloat(freq*freq*0.49*44100, 'f', 0, 64), "Hz"
+			}},
+			{Name: "resonance", MinValue: 0, Default: 32, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "drive", MinValue: 0, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(toDecibel(1+float64(v)/128*15), 'g', 3, 64), "dB"
+			}},
+		},
+		StackUse: stackUseEffect,
+	},
+	"phaser": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "stages", MinValue: 1, Default: 4, MaxValue: 8, CanSet: true, CanModulate: false},
+			{Name: "frequency", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				freq := float64(v) / 128
+				return strconv.FormatFloat(freq*freq*0.49*44100, 'f', 0, 64), "Hz"
+			}},
+			{Name: "feedback", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(float64(v-64)/64*99, 'f', 0, 64), "%" }},
+			{Name: "dry", MinValue: 0, Default: 128, MaxValue: 128, CanSet: true, CanModulate: true},
+		},
+		// The phaser unit is a chain of first order all-pass filters, all
+		// with the same frequency, mixed with the dry signal. With dry = 0, it
+		// is a plain all-pass filter.
+		StackUse: stackUseEffect,
+	},
 	"distort": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -239,10 +276,43 @@ var UnitTypes = map[string]UnitType{
 		},
 		StackUse: stackUseEffect,
 	},
+	"formant": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "vowel", MinValue: 0, Default: 0, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				const vowels = "aeiou"
+				i, f := min(v/32, 3), v%32
+				if v == 128 {
+					f = 32
+				}
+				switch f {
+				case 0:
+					return vowels[i : i+1], ""
+				case 32:
+					return vowels[i+1 : i+2], ""
+				}
+				return vowels[i:i+1] + "-" + vowels[i+1:i+2], strconv.Itoa(f*100/32) + "%"
+			}},
+			{Name: "resonance", MinValue: 1, Default: 16, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(toDecibel(128/float64(v)), 'g', 3, 64), "Q dB"
+			}},
+		},
+		// The formant unit is two parallel band-pass filters, tuned to the first
+		// two formants of the vowels a, e, i, o and u. The vowel morphs between
+		// them. The filter coefficients of the vowels are in vm.FormantTable.
+		StackUse: stackUseEffect,
+	},
 	"clip": {
 		Params:   []UnitParameter{{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false}},
 		StackUse: stackUseEffect,
 	},
+	"math": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "function", MinValue: MathAbs, Default: MathAbs, MaxValue: MathSqrt, CanSet: true, CanModulate: false, DisplayFunc: arrDispFunc([]string{"abs", "sign", "tanh", "square", "sqrt"})},
+		},
+		StackUse: stackUseEffect,
+	},
 	"pan": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -255,6 +325,21 @@ var UnitTypes = map[string]UnitType{
 			return StackUse{Inputs: [][]int{{0, 1}}, Modifies: []bool{true, true}, NumOutputs: 2}
 		},
 	},
+	"midside": {
+		Params: []UnitParameter{
+			{Name: "mode", MinValue: 0, Default: 0, MaxValue: 2, CanSet: true, CanModulate: false, DisplayFunc: arrDispFunc([]string{"width", "encode", "decode"})},
+			{Name: "width", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.Itoa(v * 100 / 64), "%"
+			}},
+		},
+		// The midside unit always works on a stereo signal. In encode mode, it
+		// converts l r into m s, where m=(l+r)/2 and s=(l-r)/2; in decode mode,
+		// back into l r. The width multiplies the side signal, so the width mode
+		// (encode and decode in one go) widens or narrows the stereo image.
+		StackUse: func(u *Unit) StackUse {
+			return StackUse{Inputs: [][]int{{0, 1}, {0, 1}}, Modifies: []bool{true, true}, NumOutputs: 2}
+		},
+	},
 	"delay": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -263,11 +348,85 @@ var UnitTypes = map[string]UnitType{
 			{Name: "feedback", MinValue: 0, Default: 96, MaxValue: 128, CanSet: true, CanModulate: true},
 			{Name: "damp", MinValue: 0, MaxValue: 128, CanSet: true, CanModulate: true},
 			{Name: "notetracking", MinValue: 0, Default: 2, MaxValue: 2, CanSet: true, CanModulate: false, DisplayFunc: arrDispFunc([]string{"fixed", "pitch", "BPM"})},
+			{Name: "pingpong", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "spread", MinValue: 0, Default: 128, MaxValue: 128, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) { return strconv.Itoa(v * 100 / 128), "%" }},
 			{Name: "delaytime", MinValue: 0, MaxValue: -1, CanSet: false, CanModulate: true},
 		},
+		// In the stereo ping-pong mode, the mono sum of the input is split
+		// between the delay lines of the channels, the left channel getting more
+		// of it as the spread grows, and the feedback of each line goes to the
+		// line of the opposite channel, so the echoes bounce between the
+		// channels.
 		DefaultVarArgs: []int{48},
 		StackUse:       stackUseEffect,
 	},
+	"pluck": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "transpose", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				relvalue := v - 64
+				if relvalue%12 == 0 {
+					return strconv.Itoa(relvalue / 12), "oct"
+				}
+				return strconv.Itoa(relvalue), "st"
+			}},
+			{Name: "detune", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return formatFloat(float64(v-64) / 64), "st" }},
+			{Name: "decay", MinValue: 0, Default: 112, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "damp", MinValue: 0, Default: 32, MaxValue: 128, CanSet: true, CanModulate: true},
+		},
+		// The pluck unit is a comb filter tuned to the note, fed with the
+		// excitation popped from the stack. It uses one delay line per channel.
+		StackUse: stackUseEffect,
+	},
+	"chorus": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "rate", MinValue: 0, Default: 24, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(float64(v*v)/16384*10, 'f', 2, 64), "Hz"
+			}},
+			{Name: "depth", MinValue: 0, Default: 32, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(float64(v) * 8 / 44100) }},
+			{Name: "delay", MinValue: 0, Default: 96, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(float64(1+v*8) / 44100) }},
+			{Name: "feedback", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(float64(v-64)/64*99, 'f', 0, 64), "%" }},
+			{Name: "spread", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(float64(v)/128*180, 'f', 1, 64), "°"
+			}},
+			{Name: "wet", MinValue: 0, Default: 96, MaxValue: 128, CanSet: true, CanModulate: true},
+		},
+		// The chorus unit is a delay line read at a position modulated by an
+		// internal sine LFO. It uses one delay line per channel; the LFO of the
+		// right channel is ahead by the spread.
+		StackUse: stackUseEffect,
+	},
+	"reverb": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "size", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) {
+				return engineeringTime(float64(ReverbLineLength(0, v)) / 44100)
+			}},
+			{Name: "predelay", MinValue: 0, Default: 0, MaxValue: 128, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) {
+				return engineeringTime(float64(ReverbPredelayLength(v)) / 44100)
+			}},
+			{Name: "decay", MinValue: 0, Default: 96, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				d := 1 - float64(v)/128
+				return strconv.FormatFloat((1-d*d)*100, 'f', 1, 64), "%"
+			}},
+			{Name: "damping", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "modulation", MinValue: 0, Default: 32, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(float64(v) / 8 / 44100) }},
+			{Name: "dry", MinValue: 0, Default: 128, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "wet", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true},
+		},
+		// The reverb unit is a feedback delay network of four delay lines,
+		// mixed with a Hadamard matrix and fed with the predelayed mono sum of
+		// the input. The line lengths are modulated by an internal LFO. It
+		// uses five delay lines: the four lines of the network and the
+		// predelay. In stereo, the channels get different taps of the network.
+		StackUse: func(u *Unit) StackUse {
+			if stereo, ok := u.Parameters["stereo"]; ok && stereo == 1 {
+				return StackUse{Inputs: [][]int{{0, 1}, {0, 1}}, Modifies: []bool{true, true}, NumOutputs: 2}
+			}
+			return StackUse{Inputs: [][]int{{0}}, Modifies: []bool{true}, NumOutputs: 1}
+		},
+	},
 	"compressor": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -280,14 +439,63 @@ var UnitTypes = map[string]UnitType{
 				return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB"
 			}},
 			{Name: "ratio", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return formatFloat(1 - float64(v)/128), "" }},
+			{Name: "sidechain", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
 		},
 		StackUse: func(u *Unit) StackUse {
+			// with sidechain, the signal on the top of the stack is the key
+			// driving the gain reduction and it gets replaced by the gain
+			if u.Parameters["sidechain"] == 1 {
+				if u.Parameters["stereo"] == 1 {
+					return StackUse{Inputs: [][]int{{0, 1}, {0, 1}}, Modifies: []bool{true, true}, NumOutputs: 2}
+				}
+				return StackUse{Inputs: [][]int{{0}}, Modifies: []bool{true}, NumOutputs: 1}
+			}
 			if stereo, ok := u.Parameters["stereo"]; ok && stereo == 1 {
 				return StackUse{Inputs: [][]int{{0, 2, 3}, {1, 2, 3}}, Modifies: []bool{false, false, true, true}, NumOutputs: 4}
 			}
 			return StackUse{Inputs: [][]int{{0, 1}}, Modifies: []bool{false, true}, NumOutputs: 2}
 		},
 	},
+	"follower": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "attack", MinValue: 0, Default: 32, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: compressorTimeDispFunc},
+			{Name: "release", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: compressorTimeDispFunc},
+		},
+		// The follower unit replaces the signal with its smoothed absolute
+		// value, to be sent to the ports of other units.
+		StackUse: stackUseEffect,
+	},
+	"slew": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "rise", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: slewTimeDispFunc},
+			{Name: "fall", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: slewTimeDispFunc},
+		},
+		// The slew unit limits how fast the signal can rise and fall; the
+		// times are how long it takes to change by 1.
+		StackUse: stackUseEffect,
+	},
+	"limiter": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "ceiling", MinValue: 1, Default: 120, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB"
+			}},
+			{Name: "release", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: compressorTimeDispFunc},
+			{Name: "lookahead", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) { return engineeringTime(float64(2*v+1) / 44100) }},
+		},
+		// The limiter unit delays the signal by the lookahead and fades in the
+		// gain reduction during the lookahead, so the output never exceeds the
+		// ceiling. It uses one delay line for the gain reduction and one per
+		// channel for the signal. In stereo, both channels get the same gain.
+		StackUse: func(u *Unit) StackUse {
+			if stereo, ok := u.Parameters["stereo"]; ok && stereo == 1 {
+				return StackUse{Inputs: [][]int{{0, 1}, {0, 1}}, Modifies: []bool{true, true}, NumOutputs: 2}
+			}
+			return StackUse{Inputs: [][]int{{0}}, Modifies: []bool{true}, NumOutputs: 1}
+		},
+	},
 	"speed": {
 		Params:   []UnitParameter{},
 		StackUse: func(u *Unit) StackUse { return StackUse{Inputs: [][]int{{0}}, Modifies: []bool{true}, NumOutputs: 0} },
@@ -344,9 +552,12 @@ var UnitTypes = map[string]UnitType{
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
 			{Name: "attack", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(math.Pow(2, 24*float64(v)/128) / 44100) }},
+			{Name: "attackcurve", MinValue: -64, MaxValue: 64, CanSet: true, CanModulate: false},
 			{Name: "decay", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(math.Pow(2, 24*float64(v)/128) / 44100) }},
+			{Name: "decaycurve", MinValue: -64, MaxValue: 64, CanSet: true, CanModulate: false},
 			{Name: "sustain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
 			{Name: "release", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return engineeringTime(math.Pow(2, 24*float64(v)/128) / 44100) }},
+			{Name: "releasecurve", MinValue: -64, MaxValue: 64, CanSet: true, CanModulate: false},
 			{Name: "gain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
 		},
 		StackUse: stackUseSource,
@@ -359,6 +570,39 @@ var UnitTypes = map[string]UnitType{
 		},
 		StackUse: stackUseSource,
 	},
+	"random": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "rate", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(math.Exp2(float64(v-64)/8), 'g', 3, 64), "Hz"
+			}},
+			{Name: "sync", MinValue: 0, Default: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "smooth", MinValue: 0, Default: 0, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: compressorTimeDispFunc},
+			{Name: "gain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
+		},
+		// The random unit holds a random value, drawing a new one rate times
+		// per second, or every rate/12 beats when synced to the tempo. The
+		// steps are counted from the song time, so synced units stay aligned
+		// with the rows, also when the playing starts from the middle of the
+		// song.
+		StackUse: stackUseSource,
+	},
+	"ramp": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "length", MinValue: 1, Default: 4, MaxValue: 128, CanSet: true, CanModulate: false},
+			{Name: "division", MinValue: 1, Default: 1, MaxValue: 48, CanSet: true, CanModulate: false},
+			{Name: "phase", MinValue: 0, Default: 0, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return strconv.FormatFloat(float64(v)/128*360, 'f', 1, 64), "°"
+			}},
+			{Name: "gain", MinValue: 0, Default: 128, MaxValue: 128, CanSet: true, CanModulate: true},
+		},
+		// The ramp unit outputs the position of the song within a period of
+		// length/division beats, rising from 0 to 1. It is derived from the
+		// song time and the tempo, so it stays locked to the rows, also when
+		// the playing starts from the middle of the song.
+		StackUse: stackUseSource,
+	},
 	"oscillator": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -377,7 +621,7 @@ var UnitTypes = map[string]UnitType{
 			{Name: "shape", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true},
 			{Name: "gain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
 			{Name: "frequency", MinValue: 0, MaxValue: -1, CanSet: false, CanModulate: true},
-			{Name: "type", MinValue: int(Sine), Default: int(Sine), MaxValue: int(Sample), CanSet: true, CanModulate: false, DisplayFunc: arrDispFunc([]string{"sine", "trisaw", "pulse", "gate", "sample"})},
+			{Name: "type", MinValue: int(Sine), Default: int(Sine), MaxValue: int(PulseAA), CanSet: true, CanModulate: false, DisplayFunc: arrDispFunc([]string{"sine", "trisaw", "pulse", "gate", "sample", "trisaw aa", "pulse aa"})},
 			{Name: "lfo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
 			{Name: "unison", MinValue: 0, MaxValue: 3, CanSet: true, CanModulate: false},
 			{Name: "samplestart", MinValue: 0, MaxValue: 1720329, CanSet: true, CanModulate: false},
@@ -386,6 +630,50 @@ var UnitTypes = map[string]UnitType{
 		},
 		StackUse: stackUseSource,
 	},
+	"wavetable": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "transpose", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				relvalue := v - 64
+				if relvalue%12 == 0 {
+					return strconv.Itoa(relvalue / 12), "oct"
+				}
+				return strconv.Itoa(relvalue), "st"
+			}},
+			{Name: "detune", MinValue: 0, Neutral: 64, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return formatFloat(float64(v-64) / 64), "st" }},
+			{Name: "position", MinValue: 0, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "gain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
+			{Name: "frames", MinValue: 1, Default: 1, MaxValue: 64, CanSet: true, CanModulate: false},
+		},
+		// VarArgs of a wavetable unit are the samples of its frames, one frame
+		// after another. The samples are in the range -128...127, with 128
+		// corresponding to 1.0. Each frame has len(VarArgs)/frames samples.
+		DefaultVarArgs: []int{0, 49, 90, 117, 127, 117, 90, 49, 0, -49, -90, -117, -127, -117, -90, -49},
+		StackUse:       stackUseSource,
+	},
+	"operator": {
+		Params: []UnitParameter{
+			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "coarse", MinValue: 0, Default: 1, MaxValue: 31, CanSet: true, CanModulate: false, DisplayFunc: func(v int) (string, string) {
+				if v == 0 {
+					return "0.5", "x"
+				}
+				return strconv.Itoa(v), "x"
+			}},
+			{Name: "fine", MinValue: 0, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) {
+				return "+" + strconv.FormatFloat(float64(v)/128*100, 'f', 1, 64), "%"
+			}},
+			{Name: "fixed", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
+			{Name: "feedback", MinValue: 0, MaxValue: 128, CanSet: true, CanModulate: true},
+			{Name: "gain", MinValue: 0, Default: 64, MaxValue: 128, CanSet: true, CanModulate: true, DisplayFunc: func(v int) (string, string) { return strconv.FormatFloat(toDecibel(float64(v)/128), 'g', 3, 64), "dB" }},
+		},
+		// The operator pops the phase modulation signal from the stack and
+		// pushes a sine wave, with the phase offset by the popped signal (1.0
+		// = a full cycle). The frequency is the note frequency times the ratio
+		// coarse*(1+fine); when fixed is 1, the note is ignored and the ratio
+		// is relative to the middle C.
+		StackUse: stackUseEffect,
+	},
 	"loadval": {
 		Params: []UnitParameter{
 			{Name: "stereo", MinValue: 0, MaxValue: 1, CanSet: true, CanModulate: false},
@@ -490,6 +778,10 @@ func compressorTimeDispFunc(v int) (string, string) {
 	return engineeringTime(sec)
 }
 
+func slewTimeDispFunc(v int) (string, string) {
+	return engineeringTime(1 / (44100 * math.Pow(2, -24*float64(v)/128)))
+}
+
 func engineeringTime(sec float64) (string, string) {
 	if sec < 1e-3 {
 		return fmt.Sprintf("%.2f", sec*1e6), "us"
@@ -513,16 +805,64 @@ func toDecibel(amplitude float64) float64 {
 }
 
 // When unit.Type = "oscillator", its unit.Parameter["Type"] tells the type of
-// the oscillator. There is five different oscillator types, so these consts
-// just enumerate them.
+// the oscillator. There is seven different oscillator types, so these consts
+// just enumerate them. TrisawAA and PulseAA are anti-aliased versions of Trisaw
+// and Pulse, slightly more expensive to compute but aliasing much less at high
+// notes.
 const (
-	Sine   = iota
-	Trisaw = iota
-	Pulse  = iota
-	Gate   = iota
-	Sample = iota
+	Sine     = iota
+	Trisaw   = iota
+	Pulse    = iota
+	Gate     = iota
+	Sample   = iota
+	TrisawAA = iota
+	PulseAA  = iota
 )
 
+// When unit.Type = "math", its unit.Parameter["function"] tells which function
+// is applied to the signal. Sqrt takes the square root of the absolute value,
+// so it never produces NaNs.
+const (
+	MathAbs    = iota
+	MathSign   = iota
+	MathTanh   = iota
+	MathSquare = iota
+	MathSqrt   = iota
+)
+
+// EnvelopeCurve maps the attackcurve, decaycurve or releasecurve parameter of
+// an envelope to the curvature c. The segment moves at 1+c*(2*d-1) times the
+// speed of a linear segment, where d is the remaining distance to the end of
+// the segment divided by the span of the segment: 1 for the attack, 1-sustain
+// for the decay and the level where the release started for the release.
+// Positive curves start fast and slow down towards the end, negative curves
+// start slow and speed up, regardless of the sustain level.
+func EnvelopeCurve(curve int) float32 {
+	return float32(curve) * 15 / 1024
+}
+
+// EnvelopeSpanEpsilon is added to the span of an envelope segment before
+// dividing the remaining distance with it, so that segments with zero span,
+// e.g. a decay to full sustain, do not divide by zero.
+const EnvelopeSpanEpsilon = 1.0 / (1 << 20)
+
+// reverbLineLengths are the lengths of the four delay lines of the reverb unit
+// at size 56, in samples. They are mutually prime, so the echoes of the lines
+// do not pile up.
+var reverbLineLengths = [4]int{1277, 1559, 1801, 2087}
+
+// ReverbLineLength returns the length of the delay line number line (0-3) of
+// a reverb unit with the given size parameter, in samples.
+func ReverbLineLength(line, size int) int {
+	return reverbLineLengths[line] * (size + 8) / 64
+}
+
+// ReverbPredelayLength returns the predelay of a reverb unit with the given
+// predelay parameter, in samples.
+func ReverbPredelayLength(predelay int) int {
+	return predelay * 64
+}
+
 // UnitNames is a list of all the names of units, sorted
 // alphabetically.
 var UnitNames []string
@@ -650,7 +990,8 @@ func (p Patch) NumVoices() int {
 }
 
 // NumDelayLines return the total number of delay lines used in the patch;
-// summing the number of delay lines of every delay unit in every instrument
+// summing the number of delay lines of every delay, pluck, chorus, limiter and
+// reverb unit in every instrument
 func (p Patch) NumDelayLines() int {
 	total := 0
 	for _, instr := range p {
@@ -658,6 +999,15 @@ func (p Patch) NumDelayLines() int {
 			if unit.Type == "delay" {
 				total += len(unit.VarArgs) * instr.NumVoices
 			}
+			if unit.Type == "pluck" || unit.Type == "chorus" {
+				total += (1 + unit.Parameters["stereo"]) * instr.NumVoices
+			}
+			if unit.Type == "limiter" {
+				total += (2 + unit.Parameters["stereo"]) * instr.NumVoices
+			}
+			if unit.Type == "reverb" {
+				total += 5 * instr.NumVoices
+			}
 		}
 	}
 	return total
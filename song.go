@@ -3,6 +3,7 @@ package sointu
 import (
 	_ "embed"
 	"errors"
+	"slices"
 )
 
 type (
@@ -47,6 +48,17 @@ type (
 		// instead of note values.
 		Effect bool `yaml:",omitempty"`
 
+		// Automation, when its UnitID is non-zero, makes this track an
+		// automation lane: instead of triggering voices, the values of the
+		// track set the targeted unit parameter at the start of each row. A
+		// value of 2 or more sets the parameter to that value, clamped to the
+		// maximum value of the parameter, hold keeps the previous value and a
+		// note off returns the parameter to the value set in the patch. As 0
+		// and 1 are the note off and hold, a lane cannot set the parameter to
+		// 0 or 1; the lowest value it can set is 2. Automation lanes have no
+		// voices; NumVoices should be 0.
+		Automation AutomationTarget `yaml:",omitempty"`
+
 		// Order is a list telling which pattern comes in which order in the song in
 		// this track.
 		Order Order `yaml:",flow"`
@@ -62,6 +74,16 @@ type (
 	// unused slots with 1s.
 	Pattern []byte
 
+	// AutomationTarget tells which parameter an automation lane sets: the
+	// parameter is found by the ID of the unit, and the port, which is the
+	// index of the parameter among the parameters of the unit that can be
+	// modulated, like the port of a send. Only the parameters that can be both
+	// set and modulated can be automated.
+	AutomationTarget struct {
+		UnitID int `yaml:",omitempty"`
+		Port   int `yaml:",omitempty"`
+	}
+
 	// Order is the pattern order for a track, in practice just a slice of
 	// integers, but provides convenience functions that return -1 values for
 	// indices out of bounds of the array, and functions to increase the size of
@@ -242,10 +264,11 @@ func (t *Track) Copy() Track {
 		patterns[i] = newPat
 	}
 	return Track{
-		NumVoices: t.NumVoices,
-		Effect:    t.Effect,
-		Order:     order,
-		Patterns:  patterns,
+		NumVoices:  t.NumVoices,
+		Effect:     t.Effect,
+		Automation: t.Automation,
+		Order:      order,
+		Patterns:   patterns,
 	}
 }
 
@@ -318,12 +341,69 @@ func (s *Song) Validate() error {
 	if len(s.Score.Tracks) == 0 {
 		return errors.New("song contains no tracks")
 	}
+	if !slices.ContainsFunc(s.Score.Tracks, func(t Track) bool { return !t.IsAutomation() }) {
+		return errors.New("song contains only automation lanes")
+	}
 	if s.Score.NumVoices() > s.Patch.NumVoices() {
 		return errors.New("Tracks use too many voices")
 	}
 	return nil
 }
 
+// IsAutomation returns true if the track is an automation lane.
+func (t *Track) IsAutomation() bool {
+	return t.Automation.UnitID != 0
+}
+
+// FindAutomationParam returns the instrument and unit index of the unit
+// targeted by an automation lane, and the targeted parameter. ok is false if the
+// unit is not found, or if the port is not a parameter that can be both set
+// and modulated.
+func (p Patch) FindAutomationParam(target AutomationTarget) (instrIndex int, unitIndex int, param UnitParameter, ok bool) {
+	if target.UnitID == 0 {
+		return 0, 0, UnitParameter{}, false
+	}
+	instrIndex, unitIndex, err := p.FindUnit(target.UnitID)
+	if err != nil {
+		return 0, 0, UnitParameter{}, false
+	}
+	param, _, ok = FindParamForModulationPort(p[instrIndex].Units[unitIndex].Type, target.Port)
+	if !ok || !param.CanSet {
+		return 0, 0, UnitParameter{}, false
+	}
+	return instrIndex, unitIndex, param, true
+}
+
+// SetLanes writes the parameters targeted by the automation lanes directly to
+// the synth, without recompiling the patch. values has one value for each
+// track, interpreted like the values in the lanes: 0 and 1 return the
+// parameter to the value set in the patch, while larger values set the
+// parameter, clamped to its maximum value. Missing values count as 0 and the
+// values of tracks that are not automation lanes are ignored. If several lanes
+// target the same parameter, the ones setting a value win.
+func (s *Song) SetLanes(synth Synth, values []byte) {
+	for _, set := range []bool{false, true} {
+		for i, t := range s.Score.Tracks {
+			var v byte
+			if i < len(values) {
+				v = values[i]
+			}
+			if (v > 1) != set || !t.IsAutomation() {
+				continue
+			}
+			instrIndex, unitIndex, param, ok := s.Patch.FindAutomationParam(t.Automation)
+			if !ok {
+				continue
+			}
+			value := s.Patch[instrIndex].Units[unitIndex].Parameters[param.Name]
+			if set {
+				value = min(int(v), param.MaxValue)
+			}
+			synth.SetParameter(t.Automation, value)
+		}
+	}
+}
+
 // *Track implements NumVoicer interface
 
 func (t *Track) GetNumVoices() int {
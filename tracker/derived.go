@@ -126,6 +126,9 @@ func (m *Model) deriveParams(unit *sointu.Unit, ret []Parameter) []Parameter {
 		if unit.Type == "send" && up.Name == "port" {
 			continue
 		}
+		if unit.Type == "wavetable" && up.Name == "frames" {
+			continue // shown as wavetableFramesParameter, as changing it changes the VarArgs
+		}
 		q := 0
 		if up.CanModulate {
 			portIndex++
@@ -147,6 +150,18 @@ func (m *Model) deriveParams(unit *sointu.Unit, ret []Parameter) []Parameter {
 			ret = append(ret, Parameter{m: m, unit: unit, index: i, vtable: &delayTimeParameter{}})
 		}
 	}
+	if unit.Type == "wavetable" {
+		frames := max(unit.Parameters["frames"], 1)
+		for len(unit.VarArgs) < frames || len(unit.VarArgs)%frames != 0 {
+			unit.VarArgs = append(unit.VarArgs, 0)
+		}
+		ret = append(ret,
+			Parameter{m: m, unit: unit, vtable: &wavetableFramesParameter{}},
+			Parameter{m: m, unit: unit, vtable: &wavetableLengthParameter{}})
+		for i := range unit.VarArgs {
+			ret = append(ret, Parameter{m: m, unit: unit, index: i, vtable: &wavetableSampleParameter{}})
+		}
+	}
 	return ret
 }
 
@@ -172,6 +187,13 @@ func (m *Model) buildTrackTitle(track int) string {
 	if track < 0 || track >= len(m.d.Song.Score.Tracks) {
 		return "?"
 	}
+	if t := m.d.Song.Score.Tracks[track]; t.IsAutomation() {
+		i, _, up, ok := m.d.Song.Patch.FindAutomationParam(t.Automation)
+		if !ok {
+			return "?"
+		}
+		return fmt.Sprintf("%s.%s", nilIsQuestionMark(m.d.Song.Patch[i].Name), up.Name)
+	}
 	firstIndex, lastIndex, err := m.instrumentRangeFor(track)
 	if err != nil {
 		return "?"
@@ -25,6 +25,7 @@ type (
 		muteHint            string
 		unmuteHint          string
 		voices              *NumericUpDownState
+		oversampling        *NumericUpDownState
 		splitInstrumentBtn  *Clickable
 		splitInstrumentHint string
 
@@ -48,6 +49,7 @@ func NewInstrumentProperties() *InstrumentProperties {
 		soloBtn:            new(Clickable),
 		muteBtn:            new(Clickable),
 		voices:             NewNumericUpDownState(),
+		oversampling:       NewNumericUpDownState(),
 		splitInstrumentBtn: new(Clickable),
 		threadBtns:         [4]*Clickable{new(Clickable), new(Clickable), new(Clickable), new(Clickable)},
 		ignoreNoteOff:      new(Clickable),
@@ -99,7 +101,7 @@ func (ip *InstrumentProperties) layout(gtx C) D {
 			layout.Rigid(thread4btn.Layout),
 		)
 	}
-	ret := ip.list.Layout(gtx, 18, func(gtx C, index int) D {
+	ret := ip.list.Layout(gtx, 19, func(gtx C, index int) D {
 		gtx.Constraints.Max.X = min(gtx.Dp(300), gtx.Constraints.Max.X)
 		gtx.Constraints.Min.X = min(gtx.Constraints.Max.X, gtx.Constraints.Min.X)
 		switch index {
@@ -117,14 +119,17 @@ func (ip *InstrumentProperties) layout(gtx C) D {
 			return layoutInstrumentPropertyLine(gtx, "Solo", soloBtn.Layout)
 		case 7:
 			return layoutInstrumentPropertyLine(gtx, "Thread", threadbtnline)
-		case 9:
+		case 8:
+			oversampling := NumUpDown(tr.Instrument().Oversampling(), tr.Theme, ip.oversampling, "Oversampling factor\n(only supported by the Go synth)")
+			return layoutInstrumentPropertyLine(gtx, "Oversampling", oversampling.Layout)
+		case 10:
 			l := Label(tr.Theme, &tr.Theme.InstrumentEditor.Properties.Label, "MIDI")
 			l.Alignment = text.Middle
 			return l.Layout(gtx)
-		case 10:
+		case 11:
 			channelLine := NumUpDown(tr.MIDI().Channel(), tr.Theme, ip.midiChannel, "0 = automatic")
 			return layoutInstrumentPropertyLine(gtx, "Channel", channelLine.Layout)
-		case 11:
+		case 12:
 			start := NumUpDown(tr.MIDI().NoteStart(), tr.Theme, ip.noteStart, "Lowest note triggering\nthis instrument")
 			end := NumUpDown(tr.MIDI().NoteEnd(), tr.Theme, ip.noteEnd, "Highest note triggering\nthis instrument")
 			noteRangeLine := func(gtx C) D {
@@ -135,19 +140,19 @@ func (ip *InstrumentProperties) layout(gtx C) D {
 				)
 			}
 			return layoutInstrumentPropertyLine(gtx, "Note range", noteRangeLine)
-		case 12:
+		case 13:
 			transpose := NumUpDown(tr.MIDI().Transpose(), tr.Theme, ip.transpose, "Transpose of the MIDI values")
 			return layoutInstrumentPropertyLine(gtx, "Transpose", transpose.Layout)
-		case 13:
+		case 14:
 			velocityBtn := ToggleIconBtn(tr.MIDI().Velocity(), tr.Theme, ip.velocity, icons.ToggleCheckBoxOutlineBlank, icons.ToggleCheckBox, "Instrument triggered by\nMIDI note", "Instrument triggered by\nMIDI velocity")
 			return layoutInstrumentPropertyLine(gtx, "Velocity", velocityBtn.Layout)
-		case 14:
+		case 15:
 			retriggerBtn := ToggleIconBtn(tr.MIDI().Change(), tr.Theme, ip.change, icons.ToggleCheckBoxOutlineBlank, icons.ToggleCheckBox, "Every note/velocity retriggers", "Retrigger only when\nnote/velocity changes")
 			return layoutInstrumentPropertyLine(gtx, "No retrigger", retriggerBtn.Layout)
-		case 15:
+		case 16:
 			noteOff := ToggleIconBtn(tr.MIDI().IgnoreNoteOff(), tr.Theme, ip.ignoreNoteOff, icons.ToggleCheckBoxOutlineBlank, icons.ToggleCheckBox, "Notes released", "Notes never released")
 			return layoutInstrumentPropertyLine(gtx, "Ignore note off", noteOff.Layout)
-		case 17:
+		case 18:
 			return layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx C) D {
 				return ip.commentEditor.Layout(gtx, tr.Instrument().Comment(), tr.Theme, &tr.Theme.InstrumentEditor.InstrumentComment, "Comment")
 			})
@@ -157,7 +162,7 @@ func (ip *InstrumentProperties) layout(gtx C) D {
 			return D{Size: image.Pt(gtx.Constraints.Max.X, px)}
 		}
 	})
-	ip.scrollBar.Layout(gtx, &tr.Theme.ScrollBar, 18, &ip.list.Position)
+	ip.scrollBar.Layout(gtx, &tr.Theme.ScrollBar, 19, &ip.list.Position)
 	return ret
 }
 
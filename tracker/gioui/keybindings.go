@@ -131,6 +131,22 @@ func (t *Tracker) KeyEvent(e key.Event, gtx C) {
 		t.Note().SubtractOctave().Do()
 	case "EditNoteOff":
 		t.Note().NoteOff().Do()
+	case "InterpolateLinear":
+		t.Note().Interpolate(tracker.LinearInterpolation).Do()
+	case "InterpolateExponential":
+		t.Note().Interpolate(tracker.ExponentialInterpolation).Do()
+	case "InterpolateSCurve":
+		t.Note().Interpolate(tracker.SCurveInterpolation).Do()
+	case "ScaleUp":
+		t.Note().Scale(125).Do()
+	case "ScaleDown":
+		t.Note().Scale(80).Do()
+	case "OffsetUp":
+		t.Note().Offset(16).Do()
+	case "OffsetDown":
+		t.Note().Offset(-16).Do()
+	case "Randomize":
+		t.Note().Randomize().Do()
 	case "RemoveUnused":
 		t.Order().RemoveUnusedPatterns().Do()
 	case "PlayCurrentPosFollow":
@@ -187,6 +203,8 @@ func (t *Tracker) KeyEvent(e key.Event, gtx C) {
 		t.Song().ExportInt16().Do()
 	case "SplitTrack":
 		t.Track().Split().Do()
+	case "AutomateParam":
+		t.Params().Automate().Do()
 	case "SplitInstrument":
 		t.Instrument().Split().Do()
 	case "ShowManual":
@@ -503,6 +503,16 @@ func (t *MenuBar) Layout(gtx C) D {
 			ActionMenuChild(tr.History().Redo(), "Redo", keyActionMap["Redo"], icons.ContentRedo),
 			DividerMenuChild(),
 			ActionMenuChild(tr.Order().RemoveUnusedPatterns(), "Remove unused data", keyActionMap["RemoveUnused"], icons.ImageCrop),
+			ActionMenuChild(tr.Params().Automate(), "Automate parameter", keyActionMap["AutomateParam"], icons.ActionTimeline),
+			DividerMenuChild(),
+			ActionMenuChild(tr.Note().Interpolate(tracker.LinearInterpolation), "Interpolate linear", keyActionMap["InterpolateLinear"], icons.EditorShowChart),
+			ActionMenuChild(tr.Note().Interpolate(tracker.ExponentialInterpolation), "Interpolate exponential", keyActionMap["InterpolateExponential"], icons.ActionTrendingUp),
+			ActionMenuChild(tr.Note().Interpolate(tracker.SCurveInterpolation), "Interpolate s-curve", keyActionMap["InterpolateSCurve"], icons.EditorShowChart),
+			ActionMenuChild(tr.Note().Scale(125), "Scale up", keyActionMap["ScaleUp"], icons.ActionZoomIn),
+			ActionMenuChild(tr.Note().Scale(80), "Scale down", keyActionMap["ScaleDown"], icons.ActionZoomOut),
+			ActionMenuChild(tr.Note().Offset(16), "Offset up", keyActionMap["OffsetUp"], icons.ContentAdd),
+			ActionMenuChild(tr.Note().Offset(-16), "Offset down", keyActionMap["OffsetDown"], icons.ContentRemove),
+			ActionMenuChild(tr.Note().Randomize(), "Randomize", keyActionMap["Randomize"], icons.AVShuffle),
 		)
 	})
 	midiBtn := MenuBtn(&t.MenuStates[2], &t.Clickables[2], "MIDI")
@@ -248,6 +248,16 @@ func (m *InstrModel) warnNoMultithreadSupport() {
 	(*Alerts)(m).ClearNamed("NoMultithreadSupport")
 }
 
+func (m *InstrModel) warnNoOversamplingSupport() {
+	for _, instr := range m.d.Song.Patch {
+		if instr.Oversampling > 1 && !m.curSynther.SupportsOversampling() {
+			(*Alerts)(m).AddNamed("NoOversamplingSupport", "The current synth does not support oversampling and the patch was configured to oversample an instrument", Warning)
+			return
+		}
+	}
+	(*Alerts)(m).ClearNamed("NoOversamplingSupport")
+}
+
 func (m *InstrModel) warnNoThread() {
 	for i, instr := range m.d.Song.Patch {
 		if instr.ThreadMaskM1 == -1 {
@@ -392,6 +402,43 @@ func (v *instrumentVoices) Range() RangeInclusive {
 	return RangeInclusive{1, (*Model)(v).remainingVoices(true, v.linkInstrTrack) + v.Value()}
 }
 
+// Oversampling returns an Int representing the oversampling factor of the
+// currently selected instrument. Only the Go synth honors it.
+func (m *InstrModel) Oversampling() Int { return MakeInt((*instrumentOversampling)(m)) }
+
+type instrumentOversampling InstrModel
+
+func (v *instrumentOversampling) Value() int {
+	if v.d.InstrIndex < 0 || v.d.InstrIndex >= len(v.d.Song.Patch) {
+		return 1
+	}
+	return max(v.d.Song.Patch[v.d.InstrIndex].Oversampling, 1)
+}
+
+func (v *instrumentOversampling) SetValue(value int) bool {
+	if v.d.InstrIndex < 0 || v.d.InstrIndex >= len(v.d.Song.Patch) {
+		return false
+	}
+	if value == 3 { // only 2x and 4x are supported: step over 3x
+		if v.Value() < 3 {
+			value = 4
+		} else {
+			value = 2
+		}
+	}
+	defer (*Model)(v).change("InstrumentOversampling", PatchChange, MinorChange)()
+	if value <= 1 {
+		value = 0 // keep the field omitted from the song file when not oversampling
+	}
+	v.d.Song.Patch[v.d.InstrIndex].Oversampling = value
+	(*InstrModel)(v).warnNoOversamplingSupport()
+	return true
+}
+
+func (v *instrumentOversampling) Range() RangeInclusive {
+	return RangeInclusive{1, vm.MAX_OVERSAMPLING}
+}
+
 // Write writes the currently selected instrument to the given io.WriteCloser.
 // If the WriteCloser is a file, the file extension is used to determine the
 // format (.json for JSON, anything else for YAML).
@@ -409,9 +456,10 @@ func (m *InstrModel) Write(w io.WriteCloser) bool {
 	var err error
 	instr := m.d.Song.Patch[m.d.InstrIndex]
 	instr2 := sointu.Instrument{ // save only the relevant fields
-		Name:    instr.Name,
-		Comment: instr.Comment,
-		Units:   instr.Units,
+		Name:         instr.Name,
+		Comment:      instr.Comment,
+		Oversampling: instr.Oversampling,
+		Units:        instr.Units,
 	}
 	if _, ok := w.(*os.File); ok {
 		instr2.Name = "" // don't save the instrument name to a file; we'll replace the instruments name with the filename when loading from a file
@@ -36,6 +36,7 @@ func (mwc *myWriteCloser) Close() error {
 func (s *modelFuzzState) Iterate(yield func(string, func(p string, t *testing.T)) bool, seed int) {
 	// Ints
 	s.IterateInt("InstrumentVoices", s.model.Instrument().Voices(), yield, seed)
+	s.IterateInt("InstrumentOversampling", s.model.Instrument().Oversampling(), yield, seed)
 	s.IterateInt("TrackVoices", s.model.Track().Voices(), yield, seed)
 	s.IterateInt("SongLength", s.model.Song().Length(), yield, seed)
 	s.IterateInt("BPM", s.model.Song().BPM(), yield, seed)
@@ -83,6 +84,12 @@ func (s *modelFuzzState) Iterate(yield func(string, func(p string, t *testing.T)
 	s.IterateAction("AddOctave", s.model.Note().AddOctave(), yield, seed)
 	s.IterateAction("SubtractOctave", s.model.Note().SubtractOctave(), yield, seed)
 	s.IterateAction("EditNoteOff", s.model.Note().NoteOff(), yield, seed)
+	s.IterateAction("InterpolateLinear", s.model.Note().Interpolate(tracker.LinearInterpolation), yield, seed)
+	s.IterateAction("InterpolateExponential", s.model.Note().Interpolate(tracker.ExponentialInterpolation), yield, seed)
+	s.IterateAction("InterpolateSCurve", s.model.Note().Interpolate(tracker.SCurveInterpolation), yield, seed)
+	s.IterateAction("ScaleUp", s.model.Note().Scale(125), yield, seed)
+	s.IterateAction("OffsetDown", s.model.Note().Offset(-16), yield, seed)
+	s.IterateAction("Randomize", s.model.Note().Randomize(), yield, seed)
 	s.IterateAction("PlaySongStart", s.model.Play().FromBeginning(), yield, seed)
 	s.IterateAction("AddOrderRowAfter", s.model.Order().AddRow(false), yield, seed)
 	s.IterateAction("AddOrderRowBefore", s.model.Order().AddRow(true), yield, seed)
@@ -90,6 +97,7 @@ func (s *modelFuzzState) Iterate(yield func(string, func(p string, t *testing.T)
 	s.IterateAction("DeleteOrderRowBackward", s.model.Order().DeleteRow(true), yield, seed)
 	s.IterateAction("SplitInstrument", s.model.Instrument().Split(), yield, seed)
 	s.IterateAction("SplitTrack", s.model.Track().Split(), yield, seed)
+	s.IterateAction("AutomateParam", s.model.Params().Automate(), yield, seed)
 	// Tables
 	s.IterateTable("Order", s.model.Order().Table(), yield, seed)
 	s.IterateTable("Notes", s.model.Note().Table(), yield, seed)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/rand/v2"
 	"time"
 
 	"github.com/vsariola/sointu"
@@ -80,6 +81,148 @@ type editNoteOff NoteModel
 
 func (m *editNoteOff) Do() { Table{(*NoteModel)(m)}.Fill(0) }
 
+// InterpolationShape tells how Interpolate fills the rows between the first and
+// the last value.
+type InterpolationShape int
+
+const (
+	LinearInterpolation      InterpolationShape = iota
+	ExponentialInterpolation                    // constant ratio between consecutive rows, for frequencies and gains
+	SCurveInterpolation                         // eases in and out of the end values
+)
+
+// Interpolate returns an Action to fill each column of the selection with
+// values interpolated between the first and the last value of the column.
+// Columns starting or ending with a hold or a note off are left untouched.
+func (m *NoteModel) Interpolate(shape InterpolationShape) Action {
+	return MakeAction(interpolateNotes{Shape: shape, NoteModel: m})
+}
+
+type interpolateNotes struct {
+	Shape InterpolationShape
+	*NoteModel
+}
+
+func (m interpolateNotes) Enabled() bool { return m.selectedRows() > 2 }
+func (m interpolateNotes) Do() {
+	m.editColumns("Interpolate", func(values []byte) {
+		a, b := float64(values[0]), float64(values[len(values)-1])
+		if a <= 1 || b <= 1 {
+			return
+		}
+		for i := 1; i < len(values)-1; i++ {
+			t := float64(i) / float64(len(values)-1)
+			var v float64
+			switch m.Shape {
+			case ExponentialInterpolation:
+				v = a * math.Pow(b/a, t)
+			case SCurveInterpolation:
+				v = a + (b-a)*t*t*(3-2*t)
+			default:
+				v = a + (b-a)*t
+			}
+			values[i] = clampValue(int(math.Round(v)))
+		}
+	})
+}
+
+// Scale returns an Action to multiply the selected values by percent / 100.
+// Holds and note offs are left untouched.
+func (m *NoteModel) Scale(percent int) Action {
+	return MakeAction(scaleNotes{Percent: percent, NoteModel: m})
+}
+
+type scaleNotes struct {
+	Percent int
+	*NoteModel
+}
+
+func (m scaleNotes) Do() {
+	m.editColumns("Scale", func(values []byte) {
+		for i, v := range values {
+			if v > 1 {
+				values[i] = clampValue(int(math.Round(float64(v) * float64(m.Percent) / 100)))
+			}
+		}
+	})
+}
+
+// Offset returns an Action to add delta to the selected values. Holds and note
+// offs are left untouched.
+func (m *NoteModel) Offset(delta int) Action {
+	return MakeAction(offsetNotes{Delta: delta, NoteModel: m})
+}
+
+type offsetNotes struct {
+	Delta int
+	*NoteModel
+}
+
+func (m offsetNotes) Do() {
+	m.editColumns("Offset", func(values []byte) {
+		for i, v := range values {
+			if v > 1 {
+				values[i] = clampValue(int(v) + m.Delta)
+			}
+		}
+	})
+}
+
+// Randomize returns an Action to fill each column of the selection with random
+// values, in the range between the first and the last value of the column,
+// which are kept. Columns starting or ending with a hold or a note off are left
+// untouched.
+func (m *NoteModel) Randomize() Action { return MakeAction((*randomizeNotes)(m)) }
+
+type randomizeNotes NoteModel
+
+func (m *randomizeNotes) Enabled() bool { return (*NoteModel)(m).selectedRows() > 2 }
+func (m *randomizeNotes) Do() {
+	(*NoteModel)(m).editColumns("Randomize", func(values []byte) {
+		a, b := values[0], values[len(values)-1]
+		if a <= 1 || b <= 1 {
+			return
+		}
+		lo, hi := int(min(a, b)), int(max(a, b))
+		for i := 1; i < len(values)-1; i++ {
+			values[i] = byte(lo + rand.IntN(hi-lo+1))
+		}
+	})
+}
+
+// editColumns calls f with the values of each column of the selection and
+// writes the values f changed back to the score, as a single undoable change.
+func (m *NoteModel) editColumns(kind string, f func(values []byte)) {
+	defer m.change(kind, MajorChange)()
+	rect := Table{m}.Range()
+	rect.Limit(m.Width(), m.Height())
+	for x := rect.TopLeft.X; x <= rect.BottomRight.X; x++ {
+		values := make([]byte, 0, rect.Height())
+		for y := rect.TopLeft.Y; y <= rect.BottomRight.Y; y++ {
+			values = append(values, m.At(Point{x, y}))
+		}
+		if len(values) == 0 {
+			continue
+		}
+		f(values)
+		for i, v := range values {
+			p := Point{x, rect.TopLeft.Y + i}
+			if v != m.At(p) {
+				m.d.Song.Score.Tracks[x].SetNote(m.d.Song.Score.SongPos(p.Y), v, m.uniquePatterns)
+			}
+		}
+	}
+}
+
+func (m *NoteModel) selectedRows() int {
+	rect := Table{m}.Range()
+	return rect.Height()
+}
+
+func clampValue(v int) byte {
+	return byte(min(max(v, 2), 255)) // 0 and 1 are note off and hold
+}
+
 // RowList is a list of all the note rows, implementing ListData & MutableListData
 // interfaces
 func (m *NoteModel) RowList() List { return List{(*noteRows)(m)} }
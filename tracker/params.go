@@ -79,6 +79,44 @@ func (s chooseSendTarget) Do() {
 	s.d.Song.Patch[si].Units[su].Parameters["port"] = s.Port
 }
 
+// Automate returns an Action to add an automation lane for the parameter
+// under the cursor, or to select the lane if the parameter already has one.
+func (m *ParamModel) Automate() Action { return MakeAction((*automateParam)(m)) }
+
+type automateParam ParamModel
+
+func (m *automateParam) target() (sointu.AutomationTarget, bool) {
+	p := (*ParamModel)(m).Item((*ParamModel)(m).Cursor())
+	port, ok := p.Port()
+	if !ok || p.UnitID() <= 0 {
+		return sointu.AutomationTarget{}, false
+	}
+	target := sointu.AutomationTarget{UnitID: p.UnitID(), Port: port}
+	if _, _, _, ok := m.d.Song.Patch.FindAutomationParam(target); !ok {
+		return sointu.AutomationTarget{}, false // e.g. parameters that can only be modulated
+	}
+	return target, true
+}
+func (m *automateParam) Enabled() bool {
+	_, ok := m.target()
+	return ok
+}
+func (m *automateParam) Do() {
+	target, ok := m.target()
+	if !ok {
+		return
+	}
+	defer (*Model)(m).change("Automate", ScoreChange, MajorChange)()
+	tracks := m.d.Song.Score.Tracks
+	index := slices.IndexFunc(tracks, func(t sointu.Track) bool { return t.Automation == target })
+	if index < 0 {
+		index = len(tracks)
+		m.d.Song.Score.Tracks = append(tracks, sointu.Track{Effect: true, Automation: target})
+	}
+	m.d.Cursor.Track = index
+	m.d.Cursor2.Track = index
+}
+
 // paramsColumns
 type paramsColumns Model
 
@@ -259,11 +297,14 @@ type (
 
 	// different parameter vtables to handle different types of parameters.
 	// Casting struct{} to interface does not cause allocations.
-	namedParameter      struct{}
-	delayTimeParameter  struct{}
-	delayLinesParameter struct{}
-	gmDlsEntryParameter struct{}
-	reverbParameter     struct{}
+	namedParameter           struct{}
+	delayTimeParameter       struct{}
+	delayLinesParameter      struct{}
+	gmDlsEntryParameter      struct{}
+	reverbParameter          struct{}
+	wavetableFramesParameter struct{}
+	wavetableLengthParameter struct{}
+	wavetableSampleParameter struct{}
 
 	ParamYieldFunc func(param Parameter) bool
 
@@ -396,6 +437,14 @@ func (n *namedParameter) Name(p *Parameter) string {
 func (n *namedParameter) Hint(p *Parameter) ParameterHint {
 	val := p.Value()
 	label := strconv.Itoa(val)
+	if p.unit.Type == "random" && p.up.Name == "rate" && p.unit.Parameters["sync"] == 1 {
+		beats := float32(max(val, 1)) / 12
+		return ParameterHint{fmt.Sprintf("%d (%.3f beats, %.3f rows)", val, beats, beats*float32(p.m.d.Song.RowsPerBeat)), true}
+	}
+	if p.unit.Type == "ramp" && (p.up.Name == "length" || p.up.Name == "division") {
+		beats := float32(max(p.unit.Parameters["length"], 1)) / float32(max(p.unit.Parameters["division"], 1))
+		return ParameterHint{fmt.Sprintf("%d (%.3f beats, %.3f rows)", val, beats, beats*float32(p.m.d.Song.RowsPerBeat)), true}
+	}
 	if p.up.DisplayFunc != nil {
 		valueInUnits, units := p.up.DisplayFunc(val)
 		label = fmt.Sprintf("%s %s", valueInUnits, units)
@@ -654,6 +703,96 @@ func (r *reverbParameter) Hint(p *Parameter) ParameterHint {
 	return ParameterHint{label, true}
 }
 
+// wavetableFramesParameter vtable
+
+func (w *wavetableFramesParameter) Value(p *Parameter) int {
+	return max(p.unit.Parameters["frames"], 1)
+}
+func (w *wavetableFramesParameter) SetValue(p *Parameter, v int) bool {
+	defer p.m.change("WavetableFramesParameter", PatchChange, MinorChange)()
+	frames := w.Value(p)
+	length := len(p.unit.VarArgs) / frames
+	varArgs := make([]int, 0, v*length)
+	for f := 0; f < v; f++ {
+		// new frames start as copies of the last frame
+		src := min(f, frames-1) * length
+		varArgs = append(varArgs, p.unit.VarArgs[src:src+length]...)
+	}
+	p.unit.VarArgs = varArgs
+	p.unit.Parameters["frames"] = v
+	return true
+}
+func (w *wavetableFramesParameter) Range(p *Parameter) RangeInclusive {
+	return RangeInclusive{Min: 1, Max: 64}
+}
+func (w *wavetableFramesParameter) Type(p *Parameter) ParameterType                { return IntegerParameter }
+func (w *wavetableFramesParameter) Name(p *Parameter) string                       { return "frames" }
+func (w *wavetableFramesParameter) RoundToGrid(p *Parameter, val int, up bool) int { return val }
+func (w *wavetableFramesParameter) Reset(p *Parameter)                             {}
+func (w *wavetableFramesParameter) Hint(p *Parameter) ParameterHint {
+	return ParameterHint{strconv.Itoa(w.Value(p)), true}
+}
+
+// wavetableLengthParameter vtable
+
+func (w *wavetableLengthParameter) Value(p *Parameter) int {
+	return len(p.unit.VarArgs) / max(p.unit.Parameters["frames"], 1)
+}
+func (w *wavetableLengthParameter) SetValue(p *Parameter, v int) bool {
+	defer p.m.change("WavetableLengthParameter", PatchChange, MinorChange)()
+	frames := max(p.unit.Parameters["frames"], 1)
+	length := w.Value(p)
+	varArgs := make([]int, frames*v)
+	for f := 0; f < frames; f++ {
+		copy(varArgs[f*v:(f+1)*v], p.unit.VarArgs[f*length:(f+1)*length])
+	}
+	p.unit.VarArgs = varArgs
+	return true
+}
+func (w *wavetableLengthParameter) Range(p *Parameter) RangeInclusive {
+	return RangeInclusive{Min: 1, Max: 255}
+}
+func (w *wavetableLengthParameter) Type(p *Parameter) ParameterType { return IntegerParameter }
+func (w *wavetableLengthParameter) Name(p *Parameter) string        { return "length" }
+func (w *wavetableLengthParameter) RoundToGrid(p *Parameter, val int, up bool) int {
+	return roundToGrid(val, 8, up)
+}
+func (w *wavetableLengthParameter) Reset(p *Parameter) {}
+func (w *wavetableLengthParameter) Hint(p *Parameter) ParameterHint {
+	return ParameterHint{strconv.Itoa(w.Value(p)) + " samples", true}
+}
+
+// wavetableSampleParameter vtable
+
+func (w *wavetableSampleParameter) Value(p *Parameter) int {
+	if p.index < 0 || p.index >= len(p.unit.VarArgs) {
+		return 0
+	}
+	return p.unit.VarArgs[p.index]
+}
+func (w *wavetableSampleParameter) SetValue(p *Parameter, v int) bool {
+	defer p.m.change("WavetableSampleParameter", PatchChange, MinorChange)()
+	p.unit.VarArgs[p.index] = v
+	return true
+}
+func (w *wavetableSampleParameter) Range(p *Parameter) RangeInclusive {
+	return RangeInclusive{Min: -128, Max: 127}
+}
+func (w *wavetableSampleParameter) Type(p *Parameter) ParameterType { return IntegerParameter }
+func (w *wavetableSampleParameter) Name(p *Parameter) string        { return "sample" }
+func (w *wavetableSampleParameter) RoundToGrid(p *Parameter, val int, up bool) int {
+	return roundToGrid(val, 16, up)
+}
+func (w *wavetableSampleParameter) Reset(p *Parameter) {}
+func (w *wavetableSampleParameter) Hint(p *Parameter) ParameterHint {
+	text := strconv.Itoa(w.Value(p))
+	if frames := max(p.unit.Parameters["frames"], 1); frames > 1 {
+		length := max(len(p.unit.VarArgs)/frames, 1)
+		text += fmt.Sprintf(" F%d", p.index/length+1)
+	}
+	return ParameterHint{text, true}
+}
+
 func roundToGrid(value, grid int, up bool) int {
 	if up {
 		return value + mod(-value, grid)
@@ -19,6 +19,7 @@ type (
 	Player struct {
 		synth   sointu.Synth // the synth used to render audio
 		song    sointu.Song  // the song being played
+		lanes   []byte       // the current values of the automation lanes, one for each track
 		playing bool         // is the player playing the score or not
 		rowtime int          // how many samples have been played in the current row
 		voices  [vm.MAX_VOICES]voice
@@ -207,10 +208,23 @@ func (p *Player) advanceRow() {
 		for i := range p.song.Score.Tracks {
 			p.processNoteEvent(NoteEvent{Channel: i, IsTrack: true, Source: p})
 		}
+		p.releaseLanes()
 		return
 	}
+	if p.synth != nil {
+		// the song time jumps when starting to play from another position
+		// or when looping, so the tempo-synced units need to be told
+		p.synth.SetSongTime(p.song.Score.SongRow(p.status.SongPos) * p.song.SamplesPerRow())
+	}
+	lanesChanged := false
 	for i, t := range p.song.Score.Tracks {
 		n := t.Note(p.status.SongPos)
+		if t.IsAutomation() {
+			if n != 1 { // hold keeps the previous value
+				lanesChanged = p.setLane(i, n) || lanesChanged
+			}
+			continue
+		}
 		switch {
 		case n == 0:
 			p.processNoteEvent(NoteEvent{Channel: i, IsTrack: true, Source: p, On: false})
@@ -218,6 +232,9 @@ func (p *Player) advanceRow() {
 			p.processNoteEvent(NoteEvent{Channel: i, IsTrack: true, Source: p, Note: n, On: true})
 		} // n = 1 means hold so do nothing
 	}
+	if lanesChanged {
+		p.updateLanes()
+	}
 	p.rowtime = 0
 	p.send(nil) // just send volume and song row information
 }
@@ -253,7 +270,17 @@ loop:
 				p.song.Patch = m
 				p.compileOrUpdateSynth()
 			case sointu.Score:
-				p.song.Score = m
+				if slices.ContainsFunc(p.lanes, func(v byte) bool { return v > 1 }) {
+					// the lanes might now target different parameters, so
+					// the old targets are returned to their values first
+					if p.synth != nil {
+						p.song.SetLanes(p.synth, nil)
+					}
+					p.song.Score = m
+					p.updateLanes()
+				} else {
+					p.song.Score = m
+				}
 			case Loop:
 				p.loop = m
 			case IsPlayingMsg:
@@ -262,6 +289,7 @@ loop:
 					for i := range p.song.Score.Tracks {
 						p.processNoteEvent(NoteEvent{Channel: i, IsTrack: true, Source: p})
 					}
+					p.releaseLanes()
 				} else {
 					TrySend(p.broker.ToModel, MsgToModel{Reset: true})
 				}
@@ -276,12 +304,18 @@ loop:
 				p.status.SongPos = m.SongPos
 				p.status.SongPos.PatternRow--
 				p.rowtime = math.MaxInt
+				lanesChanged := false
 				for i, t := range p.song.Score.Tracks {
-					if !t.Effect {
+					if t.IsAutomation() {
+						lanesChanged = p.chaseLane(i, m.SongPos) || lanesChanged
+					} else if !t.Effect {
 						// when starting to play from another position, release only non-effect tracks
 						p.processNoteEvent(NoteEvent{Channel: i, IsTrack: true, Source: p})
 					}
 				}
+				if lanesChanged {
+					p.updateLanes()
+				}
 				TrySend(p.broker.ToModel, MsgToModel{Reset: true})
 			case *NoteEvent:
 				p.events = append(p.events, *m)
@@ -393,12 +427,60 @@ func (p *Player) SendAlert(name, message string, priority AlertPriority) {
 	})
 }
 
+// setLane sets the current value of the automation lane on the given track,
+// returning true if the value changed. The synth is not updated; call
+// updateLanes after setting all the lanes.
+func (p *Player) setLane(track int, value byte) bool {
+	if track >= len(p.lanes) {
+		p.lanes = append(p.lanes, make([]byte, track+1-len(p.lanes))...)
+	}
+	if p.lanes[track] == value {
+		return false
+	}
+	p.lanes[track] = value
+	return true
+}
+
+// releaseLanes returns all the automated parameters to their values in the
+// patch.
+func (p *Player) releaseLanes() {
+	if slices.ContainsFunc(p.lanes, func(v byte) bool { return v > 1 }) {
+		clear(p.lanes)
+		p.updateLanes()
+	}
+}
+
+// updateLanes writes the current values of the lanes to the automated
+// parameters of the synth. The patch is not recompiled, so this is cheap
+// enough to be done on every row.
+func (p *Player) updateLanes() {
+	if p.synth == nil {
+		return
+	}
+	p.song.SetLanes(p.synth, p.lanes)
+}
+
+// chaseLane sets the automation lane on the given track to the last value set
+// in the lane before pos, so that the automated parameter has the right value
+// when starting to play from the middle of the song. Returns true if the value
+// of the lane changed.
+func (p *Player) chaseLane(track int, pos sointu.SongPos) bool {
+	t := p.song.Score.Tracks[track]
+	for row := p.song.Score.SongRow(pos) - 1; row >= 0; row-- {
+		if n := t.Note(p.song.Score.SongPos(row)); n != 1 { // holds keep the value of an earlier row
+			return p.setLane(track, n)
+		}
+	}
+	return p.setLane(track, 0)
+}
+
 func (p *Player) compileOrUpdateSynth() {
 	if p.song.BPM <= 0 {
 		return // bpm not set yet
 	}
+	patch := p.song.Patch
 	if p.synth != nil {
-		err := p.synth.Update(p.song.Patch, p.song.BPM)
+		err := p.synth.Update(patch, p.song.BPM)
 		if err != nil {
 			p.destroySynth()
 			p.SendAlert("PlayerCrash", fmt.Sprintf("synth.Update: %v", err), Error)
@@ -406,13 +488,16 @@ func (p *Player) compileOrUpdateSynth() {
 		}
 	} else {
 		var err error
-		p.synth, err = p.synther.Synth(p.song.Patch, p.song.BPM)
+		p.synth, err = p.synther.Synth(patch, p.song.BPM)
 		if err != nil {
 			p.destroySynth()
 			p.SendAlert("PlayerCrash", fmt.Sprintf("synther.Synth: %v", err), Error)
 			return
 		}
 	}
+	if slices.ContainsFunc(p.lanes, func(v byte) bool { return v > 1 }) {
+		p.updateLanes() // the compiled patch has the values set in the patch
+	}
 	voice := 0
 	for _, instr := range p.song.Patch {
 		if instr.Mute {
@@ -463,6 +548,9 @@ func (p *Player) processNoteEvent(ev NoteEvent) {
 		voiceStart = p.song.Patch.FirstVoiceForInstrument(ev.Channel)
 		voiceEnd = voiceStart + p.song.Patch[ev.Channel].NumVoices
 	}
+	if voiceStart >= voiceEnd {
+		return // e.g. automation lanes have no voices to trigger
+	}
 	var age int = 0
 	oldestReleased := false
 	oldestVoice := 0
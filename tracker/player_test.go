@@ -0,0 +1,94 @@
+package tracker_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/tracker"
+	"github.com/vsariola/sointu/vm"
+)
+
+func TestChaseLane(t *testing.T) {
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+		{Type: "loadval", ID: 1, Parameters: map[string]int{"stereo": 1, "value": 64}},
+		{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+	}}}
+	song := sointu.Song{BPM: 100, RowsPerBeat: 4, Patch: patch, Score: sointu.Score{RowsPerPattern: 4, Length: 3, Tracks: []sointu.Track{
+		{NumVoices: 1, Order: sointu.Order{0, 0, 0}, Patterns: []sointu.Pattern{{64, 1, 1, 1}}},
+		{Automation: sointu.AutomationTarget{UnitID: 1, Port: 0}, Order: sointu.Order{0, 1, 2}, Patterns: []sointu.Pattern{{0, 96, 1, 1}, {1, 1, 1, 1}, {0, 1, 1, 1}}},
+	}}}
+	for _, c := range []struct {
+		pos      sointu.SongPos
+		expected float32
+	}{
+		{sointu.SongPos{OrderRow: 0, PatternRow: 0}, 0},   // the lane has not set the value yet
+		{sointu.SongPos{OrderRow: 0, PatternRow: 3}, 0.5}, // the value 96 is held
+		{sointu.SongPos{OrderRow: 1, PatternRow: 2}, 0.5}, // the value 96 is held over the pattern boundary
+		{sointu.SongPos{OrderRow: 2, PatternRow: 1}, 0},   // the lane was released
+	} {
+		broker := tracker.NewBroker()
+		player := tracker.NewPlayer(broker, vm.GoSynther{})
+		broker.ToPlayer <- song
+		broker.ToPlayer <- tracker.StartPlayMsg{SongPos: c.pos}
+		buffer := make(sointu.AudioBuffer, 100) // less than a row, so the lane does not advance
+		player.Process(buffer, NullContext{})
+		if d := math.Abs(float64(buffer[len(buffer)-1][0] - c.expected)); d > 1e-6 {
+			t.Errorf("starting from %v: expected %v, got %v", c.pos, c.expected, buffer[len(buffer)-1][0])
+		}
+	}
+}
+
+func TestRampStartsFromSongPos(t *testing.T) {
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+		{Type: "ramp", Parameters: map[string]int{"stereo": 1, "length": 2, "division": 1, "phase": 0, "gain": 128}},
+		{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+	}}}
+	song := sointu.Song{BPM: 100, RowsPerBeat: 4, Patch: patch, Score: sointu.Score{RowsPerPattern: 4, Length: 3, Tracks: []sointu.Track{
+		{NumVoices: 1, Order: sointu.Order{0, 0, 0}, Patterns: []sointu.Pattern{{64, 1, 1, 1}}},
+	}}}
+	for _, c := range []struct {
+		pos      sointu.SongPos
+		expected float32
+	}{
+		{sointu.SongPos{OrderRow: 0, PatternRow: 0}, 0},
+		{sointu.SongPos{OrderRow: 0, PatternRow: 3}, 0.375}, // 3 rows = 0.75 beats of the 2 beat period
+		{sointu.SongPos{OrderRow: 1, PatternRow: 2}, 0.75},  // 6 rows = 1.5 beats of the 2 beat period
+		{sointu.SongPos{OrderRow: 2, PatternRow: 0}, 0},     // 8 rows = a full period
+	} {
+		broker := tracker.NewBroker()
+		player := tracker.NewPlayer(broker, vm.GoSynther{})
+		broker.ToPlayer <- song
+		buffer := make(sointu.AudioBuffer, 1000)
+		player.Process(buffer, NullContext{}) // the synth time runs before the playing starts
+		broker.ToPlayer <- tracker.StartPlayMsg{SongPos: c.pos}
+		player.Process(buffer, NullContext{})
+		if d := math.Abs(float64(buffer[0][0] - c.expected)); d > 1e-4 {
+			t.Errorf("starting from %v: expected %v, got %v", c.pos, c.expected, buffer[0][0])
+		}
+	}
+}
+
+func TestLaneKeptOverPatchUpdate(t *testing.T) {
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+		{Type: "loadval", ID: 1, Parameters: map[string]int{"stereo": 1, "value": 64}},
+		{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+	}}}
+	song := sointu.Song{BPM: 100, RowsPerBeat: 4, Patch: patch, Score: sointu.Score{RowsPerPattern: 4, Length: 1, Tracks: []sointu.Track{
+		{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 1, 1}}},
+		{Automation: sointu.AutomationTarget{UnitID: 1, Port: 0}, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{96, 1, 1, 1}}},
+	}}}
+	broker := tracker.NewBroker()
+	player := tracker.NewPlayer(broker, vm.GoSynther{})
+	broker.ToPlayer <- song
+	broker.ToPlayer <- tracker.StartPlayMsg{SongPos: sointu.SongPos{}}
+	buffer := make(sointu.AudioBuffer, 100)
+	player.Process(buffer, NullContext{})
+	// recompiling the patch writes the values of the patch to the synth, so
+	// the player has to write the lanes again
+	broker.ToPlayer <- song.Patch.Copy()
+	player.Process(buffer, NullContext{})
+	if d := math.Abs(float64(buffer[len(buffer)-1][0] - 0.5)); d > 1e-6 {
+		t.Errorf("expected the lane to keep its value 0.5 after the patch update, got %v", buffer[len(buffer)-1][0])
+	}
+}
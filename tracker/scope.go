@@ -83,24 +83,28 @@ func (s *ScopeModel) Envelope() (Envelope, bool) {
 	sustain := (float32)(p["sustain"]) / 128.0
 	release := nonLinearMap((float32)(p["release"]) / 128.0)
 	gain := (float32)(p["gain"]) / 128.0
+	if gain == 0 { // a flat line; the segments would never end, as their slopes are zero
+		ret[0] = EnvelopePoint{Position: 0}
+		return ret, true
+	}
 	curpos := 0
 	for i := 0; i < 3; i++ {
 		var nextpos int
 		switch i {
 		case 0:
-			ret[i] = EnvelopePoint{Position: curpos, Level: 0, Slope: attack * gain}
-			nextpos = curpos + int(math.Ceil(float64(1/attack)))
+			ret[i] = envelopeSegment(curpos, 0, gain, attack, p["attackcurve"], gain)
+			nextpos = curpos + ret[i].length()
 		case 1:
-			ret[i] = EnvelopePoint{Position: curpos, Level: gain, Slope: -decay * gain}
-			nextpos = curpos + int(math.Ceil(float64((1-sustain)/decay)))
+			ret[i] = envelopeSegment(curpos, gain, sustain*gain, decay, p["decaycurve"], gain)
+			nextpos = curpos + ret[i].length()
 		case 2:
 			ret[i] = EnvelopePoint{Position: curpos, Level: sustain * gain, Slope: 0}
 			nextpos = math.MaxInt
 		}
 		if nextpos >= releasePos {
-			v := ret[i].Level + ret[i].Slope*float32(releasePos-curpos)
-			ret[i+1] = EnvelopePoint{Position: releasePos, Level: v, Slope: -release * gain}
-			ret[i+2] = EnvelopePoint{Position: releasePos + int(math.Ceil(float64(v/(release*gain)))), Level: 0, Slope: 0}
+			v := ret[i].Value(releasePos)
+			ret[i+1] = envelopeSegment(releasePos, v, 0, release, p["releasecurve"], gain)
+			ret[i+2] = EnvelopePoint{Position: releasePos + ret[i+1].length(), Level: 0, Slope: 0}
 			break
 		}
 		curpos = nextpos
@@ -108,6 +112,22 @@ func (s *ScopeModel) Envelope() (Envelope, bool) {
 	return ret, true
 }
 
+// envelopeSegment returns the point where an envelope segment starts from
+// level and moves towards target. rate is the speed of a linear segment
+// without the gain applied and curve the curve parameter of the segment.
+func envelopeSegment(position int, level, target, rate float32, curve int, gain float32) EnvelopePoint {
+	c := sointu.EnvelopeCurve(curve)
+	// the envelope moves at rate*(1+c*(2*d/s-1)) = rate*(1-c) + 2*c*rate/s*d,
+	// where d is the remaining distance to the target and s the span of the
+	// segment, both without the gain applied
+	span := float32(math.Abs(float64(target-level))) / gain
+	slope := rate * (1 - c) * gain
+	if target < level {
+		slope = -slope
+	}
+	return EnvelopePoint{Position: position, Level: level, Slope: slope, Bend: 2 * c * rate / (span + sointu.EnvelopeSpanEpsilon), Distance: target - level}
+}
+
 func nonLinearMap(value float32) float32 {
 	return float32(math.Exp2(float64(-24 * value)))
 }
@@ -117,6 +137,11 @@ type Envelope [5]EnvelopePoint
 type EnvelopePoint struct {
 	Position     int
 	Level, Slope float32
+	// Bend is non-zero for curved segments, which approach their end
+	// exponentially: the speed is Slope plus Bend times the remaining distance
+	// to the end of the segment. Distance is the change of the level from
+	// Position to the end of the segment.
+	Bend, Distance float32
 }
 
 func (e *Envelope) Value(position int) float32 {
@@ -129,7 +154,28 @@ func (e *Envelope) Value(position int) float32 {
 }
 
 func (e *EnvelopePoint) Value(position int) float32 {
-	return e.Level + e.Slope*float32(position-e.Position)
+	t := float64(position - e.Position)
+	if e.Bend == 0 {
+		return e.Level + e.Slope*float32(t)
+	}
+	v := (float64(e.Distance) + float64(e.Slope)/float64(e.Bend)) * -math.Expm1(-float64(e.Bend)*t)
+	if math.Abs(v) > math.Abs(float64(e.Distance)) {
+		v = float64(e.Distance) // past the end of the segment
+	}
+	return e.Level + float32(v)
+}
+
+// length returns the number of samples it takes to reach the end of the
+// segment.
+func (e *EnvelopePoint) length() int {
+	if e.Slope == 0 {
+		return math.MaxInt
+	}
+	t := float64(e.Distance / e.Slope)
+	if e.Bend != 0 {
+		t = math.Log1p(float64(e.Bend)*t) / float64(e.Bend)
+	}
+	return int(math.Ceil(t))
 }
 
 // processAudioBuffer fills the oscilloscope buffer with audio data from the
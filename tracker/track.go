@@ -3,6 +3,7 @@ package tracker
 import (
 	"fmt"
 	"math"
+	"slices"
 
 	"github.com/vsariola/sointu"
 	"github.com/vsariola/sointu/vm"
@@ -113,9 +114,15 @@ func (v *trackVoices) Value() int {
 	if t < 0 || t >= len(v.d.Song.Score.Tracks) {
 		return 1
 	}
+	if v.d.Song.Score.Tracks[t].IsAutomation() {
+		return 0 // automation lanes have no voices
+	}
 	return max(v.d.Song.Score.Tracks[t].NumVoices, 1)
 }
 func (m *trackVoices) SetValue(value int) bool {
+	if t := m.d.Cursor.Track; t >= 0 && t < len(m.d.Song.Score.Tracks) && m.d.Song.Score.Tracks[t].IsAutomation() {
+		return false
+	}
 	defer (*Model)(m).change("TrackVoices", SongChange, MinorChange)()
 	voiceIndex := m.d.Song.Score.FirstVoiceForTrack(m.d.Cursor.Track)
 	voiceRange := Range{voiceIndex, voiceIndex + m.d.Song.Score.Tracks[m.d.Cursor.Track].NumVoices}
@@ -131,6 +138,9 @@ func (v *trackVoices) Range() RangeInclusive {
 	if t < 0 || t >= len(v.d.Song.Score.Tracks) {
 		return RangeInclusive{1, 1}
 	}
+	if v.d.Song.Score.Tracks[t].IsAutomation() {
+		return RangeInclusive{0, 0}
+	}
 	return RangeInclusive{1, (*Model)(v).remainingVoices(v.linkInstrTrack, true) + v.d.Song.Score.Tracks[t].NumVoices}
 }
 
@@ -146,6 +156,20 @@ func (v *trackList) SetSelected2(value int) { v.d.Cursor2.Track = value }
 func (v *trackList) Count() int             { return len((*Model)(v).d.Song.Score.Tracks) }
 
 func (v *trackList) Move(r Range, delta int) (ok bool) {
+	tracks := v.d.Song.Score.Tracks
+	if r.Len() > 0 && tracks[r.Start].IsAutomation() {
+		// automation lanes have no voices, so they are moved by their index,
+		// but only among the other lanes at the end
+		for i := min(r.Start, r.Start+delta); i < max(r.End, r.End+delta); i++ {
+			if !tracks[i].IsAutomation() {
+				return false
+			}
+		}
+		moved := slices.Clone(tracks[r.Start:r.End])
+		tracks = slices.Delete(slices.Clone(tracks), r.Start, r.End)
+		v.d.Song.Score.Tracks = slices.Insert(tracks, r.Start+delta, moved...)
+		return true
+	}
 	voiceDelta := 0
 	if delta < 0 {
 		voiceDelta = -VoiceRange(v.d.Song.Score.Tracks, Range{r.Start + delta, r.Start}).Len()
@@ -161,6 +185,15 @@ func (v *trackList) Move(r Range, delta int) (ok bool) {
 
 func (v *trackList) Delete(r Range) (ok bool) {
 	ranges := Complement(VoiceRange(v.d.Song.Score.Tracks, r))
+	// the automation lanes have no voices, so delete the ones in the range
+	// by their index; this does not change the voices of the other tracks
+	tracks := make([]sointu.Track, 0, len(v.d.Song.Score.Tracks))
+	for i, t := range v.d.Song.Score.Tracks {
+		if !t.IsAutomation() || i < r.Start || i >= r.End {
+			tracks = append(tracks, t)
+		}
+	}
+	v.d.Song.Score.Tracks = tracks
 	return (*Model)(v).sliceInstrumentsTracks(v.linkInstrTrack, true, ranges[:]...)
 }
 
@@ -118,10 +118,12 @@ func (m *Model) sliceInstrumentsTracks(instruments, tracks bool, ranges ...Range
 		}
 	}
 	if tracks {
-		m.d.Song.Score.Tracks, ok = VoiceSlice(m.d.Song.Score.Tracks, ranges...)
+		voiced, lanes := splitLanes(m.d.Song.Score.Tracks)
+		voiced, ok = VoiceSlice(voiced, ranges...)
 		if !ok {
 			goto fail
 		}
+		m.d.Song.Score.Tracks = append(voiced, lanes...)
 	}
 	return true
 fail:
@@ -167,10 +169,13 @@ func (m *Model) addVoices(voiceIndex int, p sointu.Patch, t []sointu.Track, inst
 		}
 	}
 	if tracks {
-		m.d.Song.Score.Tracks, trackRange, ok = VoiceInsert(m.d.Song.Score.Tracks, voiceIndex, addedLength, t...)
+		voiced, lanes := splitLanes(m.d.Song.Score.Tracks)
+		addedVoiced, addedLanes := splitLanes(t)
+		voiced, trackRange, ok = VoiceInsert(voiced, voiceIndex, addedLength, addedVoiced...)
 		if !ok {
 			goto fail
 		}
+		m.d.Song.Score.Tracks = append(append(voiced, lanes...), addedLanes...)
 	}
 	return instrRange, trackRange, true
 fail:
@@ -179,6 +184,21 @@ fail:
 	return Range{}, Range{}, false
 }
 
+// splitLanes splits the tracks into the ordinary tracks and the automation
+// lanes. The lanes have no voices, so they would be lost when slicing the
+// tracks by voices; instead, they are always kept after the ordinary tracks.
+func splitLanes(tracks []sointu.Track) (voiced, lanes []sointu.Track) {
+	voiced = make([]sointu.Track, 0, len(tracks))
+	for _, t := range tracks {
+		if t.IsAutomation() {
+			lanes = append(lanes, t)
+		} else {
+			voiced = append(voiced, t)
+		}
+	}
+	return voiced, lanes
+}
+
 func (m *Model) remainingVoices(instruments, tracks bool) (ret int) {
 	ret = math.MaxInt
 	if instruments {
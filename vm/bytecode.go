@@ -3,6 +3,7 @@ package vm
 import (
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/vsariola/sointu"
 )
@@ -29,6 +30,12 @@ type (
 		// the same delay times.
 		DelayTimes []uint16
 
+		// Wavetables is a table of the samples of the wavetable units, as
+		// 16-bit signed integers. The wavetable unit only stores the index of
+		// its first sample in this table, the length of a frame and the number
+		// of frames. Wavetables that repeat each other are stored only once.
+		Wavetables []uint16
+
 		// SampleOffsets is a table of sample offsets, which tell where to find
 		// a particular sample in the sample data loaded from gm.dls. The sample
 		// offsets are used by the oscillator units that are configured to use
@@ -46,6 +53,20 @@ type (
 
 		// NumVoices is the total number of voices in the patch
 		NumVoices uint32
+
+		// parameterOperands tells, for each parameter that can be automated,
+		// which operands hold its value. Units encoded several times have
+		// several operands.
+		parameterOperands map[sointu.AutomationTarget][]int
+	}
+
+	// Lane is an entry in the table telling which operand an automation lane
+	// sets. The players write the values of the lane directly into the
+	// operand.
+	Lane struct {
+		Track   int    // index of the automation lane in the score
+		Operand uint16 // index of the operand set by the lane
+		Value   byte   // the value of the parameter in the patch, restored when the lane is released
 	}
 
 	// SampleOffset is an entry in the sample offset table
@@ -57,14 +78,20 @@ type (
 )
 
 type bytecodeBuilder struct {
-	sampleOffsetMap map[SampleOffset]int
-	globalAddrs     map[int]uint16
-	globalFixups    map[int]([]int)
-	localAddrs      map[int]uint16
-	localFixups     map[int]([]int)
-	voiceNo         int
-	delayIndices    [][]int
-	unitNo          int
+	sampleOffsetMap  map[SampleOffset]int
+	globalAddrs      map[int]uint16
+	globalFixups     map[int]([]int)
+	localAddrs       map[int]uint16
+	localFixups      map[int]([]int)
+	voiceNo          int
+	delayIndices     [][]int
+	wavetableIndices [][]int
+	unitNo           int
+	unitID           int
+	bpm              int
+	// unitOperands tells, for each unit ID, where the operands of the unit
+	// start. Units encoded several times have several entries.
+	unitOperands map[int][]int
 	Bytecode
 }
 
@@ -77,6 +104,9 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 		if instr.NumVoices < 1 {
 			return nil, errors.New("Each instrument must have at least 1 voice")
 		}
+		if o := instr.Oversampling; o > 1 && o != 2 && o != 4 {
+			return nil, fmt.Errorf("Instrument %v has oversampling factor %v; only 2x and 4x oversampling are supported", instrIndex, o)
+		}
 		for unitIndex, unit := range instr.Units {
 			if unit.Type == "" || unit.Disabled { // empty units are just ignored & skipped
 				continue
@@ -85,6 +115,7 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 			if !ok {
 				return nil, fmt.Errorf(`VM is not configured to support unit type "%v"`, unit.Type)
 			}
+			b.unitID = unit.ID
 			if unit.ID != 0 {
 				b.idLabel(unit.ID)
 			}
@@ -110,6 +141,10 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 					flags = 0x04
 				case sointu.Sample:
 					flags = 0x80
+				case sointu.TrisawAA:
+					flags = 0x24 // the gate bit together with trisaw or pulse bit means anti-aliased
+				case sointu.PulseAA:
+					flags = 0x14
 				}
 				if p["lfo"] == 1 {
 					flags += 0x08
@@ -129,6 +164,31 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 				b.op(opcode + p["stereo"])
 				b.defOperands(unit)
 				b.operand(b.delayIndices[instrIndex][unitIndex], countTrack)
+				if featureSet.SupportsParamValue("delay", "pingpong", 1) { // the spread is only needed when some delay uses the ping-pong mode
+					b.operand(p["pingpong"] * p["stereo"] * (p["spread"] + 1)) // 0 means no ping-pong
+				}
+			case "reverb":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.operand(b.delayIndices[instrIndex][unitIndex])
+			case "wavetable":
+				frames := max(p["frames"], 1)
+				length := len(unit.VarArgs) / frames
+				if length < 1 || length > 255 || frames > 256 {
+					return nil, fmt.Errorf("Wavetable frames should have 1-255 samples each; instrument %v has a wavetable with %v samples in %v frames", instrIndex, len(unit.VarArgs), frames)
+				}
+				for _, v := range unit.VarArgs {
+					if v < -128 || v > 127 {
+						return nil, fmt.Errorf("Wavetable samples should be in the range -128...127; instrument %v has a wavetable with a sample %v", instrIndex, v)
+					}
+				}
+				index := b.wavetableIndices[instrIndex][unitIndex]
+				if index+len(unit.VarArgs) > MAX_WAVETABLE_SAMPLES {
+					return nil, fmt.Errorf("Patch uses too many wavetable samples; at most %v samples are supported", MAX_WAVETABLE_SAMPLES)
+				}
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.operand(index, index>>8, length, frames-1)
 			case "aux", "in":
 				b.op(opcode + p["stereo"])
 				b.defOperands(unit)
@@ -153,6 +213,67 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 				b.op(opcode + p["stereo"])
 				b.defOperands(unit)
 				b.operand(flags)
+			case "phaser":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				// the unit state holds eight stages, so in stereo, each
+				// channel gets four of them
+				maxStages := 8
+				if p["stereo"] == 1 {
+					maxStages = 4
+				}
+				b.operand(min(max(p["stages"], 1), maxStages))
+			case "random":
+				// the step increment per sample is precomputed here, so that
+				// the VMs don't need to know the tempo
+				var inc float64
+				if p["sync"] == 1 {
+					inc = float64(b.bpm) * 12 / float64(max(p["rate"], 1)) / 60 / 44100
+				} else {
+					inc = math.Exp2(float64(p["rate"]-64)/8) / 44100
+				}
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.floatOperand(float32(inc))
+			case "ramp":
+				inc := float64(b.bpm) * float64(max(p["division"], 1)) / float64(max(p["length"], 1)) / 60 / 44100
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.floatOperand(float32(inc))
+			case "math":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.operand(1 << min(max(p["function"], 0), sointu.MathSqrt)) // one bit per function, so the x86 code can test them
+			case "midside":
+				b.op(opcode)
+				b.defOperands(unit)
+				b.operand([]int{3, 1, 2}[min(max(p["mode"], 0), 2)]) // bit 0: encode, bit 1: decode
+			case "envelope":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				if featureSet.SupportsParamValueOtherThan("envelope", "attackcurve", 0) ||
+					featureSet.SupportsParamValueOtherThan("envelope", "decaycurve", 0) ||
+					featureSet.SupportsParamValueOtherThan("envelope", "releasecurve", 0) {
+					b.operand(p["attackcurve"]+64, p["decaycurve"]+64, p["releasecurve"]+64) // the curves are only needed when some envelope is not linear
+				}
+			case "compressor":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				if featureSet.SupportsParamValue("compressor", "sidechain", 1) { // the flag is only needed when some compressor uses a sidechain
+					b.operand(p["sidechain"])
+				}
+			case "limiter":
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.operand(p["lookahead"])
+			case "operator":
+				flags := max(p["coarse"]*2, 1) // the lowest 7 bits are twice the ratio, coarse = 0 meaning ratio 0.5
+				if p["fixed"] == 1 {
+					flags += 0x80
+				}
+				b.op(opcode + p["stereo"])
+				b.defOperands(unit)
+				b.operand(flags)
 			case "send":
 				targetID := unit.Parameters["target"]
 				targetInstrIndex, _, err := patch.FindUnit(targetID)
@@ -209,9 +330,41 @@ func NewBytecode(patch sointu.Patch, featureSet FeatureSet, bpm int) (*Bytecode,
 		}
 		b.opFinish(instr)
 	}
+	b.mapParameterOperands(patch)
 	return &b.Bytecode, nil
 }
 
+// LaneTable returns the table of the operands set by the automation lanes of
+// the score, in the order of the tracks. The bytecode should have been compiled
+// from the patch. The operands of a unit encoded several times, like a send to
+// all the voices of another instrument, are repeated, so a lane targeting such
+// a unit has an entry for each copy. Lanes targeting parameters that cannot be
+// automated are left out.
+func (b *Bytecode) LaneTable(patch sointu.Patch, score sointu.Score) []Lane {
+	var ret []Lane
+	for t, track := range score.Tracks {
+		instrIndex, unitIndex, param, ok := patch.FindAutomationParam(track.Automation)
+		if !ok {
+			continue
+		}
+		value := byte(patch[instrIndex].Units[unitIndex].Parameters[param.Name])
+		for _, o := range b.ParameterOperands(track.Automation) {
+			ret = append(ret, Lane{Track: t, Operand: uint16(o), Value: value})
+		}
+	}
+	return ret
+}
+
+// ParameterOperands returns the indices of the operands holding the value of
+// the parameter targeted by an automation lane. Writing a value to these
+// operands changes the parameter without recompiling the patch. Parameters
+// that cannot be automated have no operands, as does the color of an
+// oscillator playing a sample, as its operand is the index of the sample
+// instead.
+func (b *Bytecode) ParameterOperands(target sointu.AutomationTarget) []int {
+	return b.parameterOperands[target]
+}
+
 func newBytecodeBuilder(patch sointu.Patch, bpm int) *bytecodeBuilder {
 	var polyphonyBitmask uint32 = 0
 	for _, instr := range patch {
@@ -221,25 +374,86 @@ func newBytecodeBuilder(patch sointu.Patch, bpm int) *bytecodeBuilder {
 		polyphonyBitmask <<= 1 // ...and the last bit is zero, to denote "change instrument"
 	}
 	delayTimesInt, delayIndices := constructDelayTimeTable(patch, bpm)
+	wavetablesInt, wavetableIndices := constructWavetableTable(patch)
 	delayTimesU16 := make([]uint16, len(delayTimesInt))
 	for i, d := range delayTimesInt {
 		delayTimesU16[i] = uint16(d)
 	}
+	wavetablesU16 := make([]uint16, len(wavetablesInt))
+	for i, w := range wavetablesInt {
+		wavetablesU16[i] = uint16(w)
+	}
 	c := bytecodeBuilder{
-		Bytecode:        Bytecode{PolyphonyBitmask: polyphonyBitmask, NumVoices: uint32(patch.NumVoices()), DelayTimes: delayTimesU16},
-		sampleOffsetMap: map[SampleOffset]int{},
-		globalAddrs:     map[int]uint16{},
-		globalFixups:    map[int]([]int){},
-		localAddrs:      map[int]uint16{},
-		localFixups:     map[int]([]int){},
-		delayIndices:    delayIndices}
+		Bytecode:         Bytecode{PolyphonyBitmask: polyphonyBitmask, NumVoices: uint32(patch.NumVoices()), DelayTimes: delayTimesU16, Wavetables: wavetablesU16, parameterOperands: map[sointu.AutomationTarget][]int{}},
+		unitOperands:     map[int][]int{},
+		sampleOffsetMap:  map[SampleOffset]int{},
+		globalAddrs:      map[int]uint16{},
+		globalFixups:     map[int]([]int){},
+		localAddrs:       map[int]uint16{},
+		localFixups:      map[int]([]int){},
+		delayIndices:     delayIndices,
+		wavetableIndices: wavetableIndices,
+		bpm:              bpm}
 	return &c
 }
 
-// op adds a command to the bytecode, and increments the unit number
+// FormantTable has, for each of the vowels a, e, i, o and u, the state variable
+// filter coefficients 2*sin(pi*f/44100) of the first two formants and the
+// relative gain of the second formant, all scaled by 32768. The compiled
+// players include it as a constant table when the patch uses the formant
+// unit.
+var FormantTable = func() []uint16 {
+	vowels := [][3]float64{{730, 1090, .5}, {530, 1840, .4}, {270, 2290, .3}, {570, 840, .5}, {300, 870, .3}}
+	var ret []uint16
+	for _, v := range vowels {
+		ret = append(ret,
+			uint16(math.Round(2*math.Sin(math.Pi*v[0]/44100)*32768)),
+			uint16(math.Round(2*math.Sin(math.Pi*v[1]/44100)*32768)),
+			uint16(math.Round(v[2]*32768)))
+	}
+	return ret
+}()
+
+// op adds a command to the bytecode, and increments the unit number. If the
+// unit has an ID, records where its operands start.
 func (b *bytecodeBuilder) op(opcode int) {
 	b.Opcodes = append(b.Opcodes, byte(opcode))
 	b.unitNo++
+	if b.unitID != 0 {
+		b.unitOperands[b.unitID] = append(b.unitOperands[b.unitID], len(b.Operands))
+	}
+}
+
+// mapParameterOperands records which operands hold the parameters that can be
+// automated, from where the operands of each unit start. The operands are the
+// parameters that can be both set and modulated, in order, while the ports
+// count all the parameters that can be modulated.
+func (b *bytecodeBuilder) mapParameterOperands(patch sointu.Patch) {
+	for _, instr := range patch {
+		for _, unit := range instr.Units {
+			starts := b.unitOperands[unit.ID]
+			if unit.ID == 0 || len(starts) == 0 {
+				continue
+			}
+			offset, port := 0, 0
+			for _, p := range sointu.UnitTypes[unit.Type].Params {
+				if !p.CanModulate {
+					continue
+				}
+				sample := unit.Type == "oscillator" && p.Name == "color" && unit.Parameters["type"] == sointu.Sample
+				if p.CanSet && !sample {
+					target := sointu.AutomationTarget{UnitID: unit.ID, Port: port}
+					for _, start := range starts {
+						b.parameterOperands[target] = append(b.parameterOperands[target], start+offset)
+					}
+				}
+				if p.CanSet {
+					offset++
+				}
+				port++
+			}
+		}
+	}
 }
 
 // opFinish adds a command to the bytecode that marks the end of an instrument, resets the unit number and increments the voice number
@@ -259,6 +473,13 @@ func (b *bytecodeBuilder) operand(operands ...int) {
 	}
 }
 
+// floatOperand appends a float32 to the operand stream, in little endian byte
+// order
+func (b *bytecodeBuilder) floatOperand(value float32) {
+	bits := math.Float32bits(value)
+	b.operand(int(bits&255), int(bits>>8&255), int(bits>>16&255), int(bits>>24))
+}
+
 // defOperands appends the operands to the stream for all parameters that can be
 // modulated and set
 func (b *bytecodeBuilder) defOperands(unit sointu.Unit) {
@@ -2,6 +2,7 @@ package bridge
 
 // #cgo CFLAGS: -I"${SRCDIR}/../../../build/"
 // #cgo LDFLAGS: "${SRCDIR}/../../../build/libsointu.a"
+// #include <stdlib.h>
 // #include <sointu.h>
 import "C"
 import (
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unsafe"
 
 	"github.com/vsariola/sointu"
 	"github.com/vsariola/sointu/vm"
@@ -18,12 +20,14 @@ type NativeSynther struct {
 }
 
 type NativeSynth struct {
-	csynth  C.Synth
-	cpuLoad sointu.CPULoad
+	csynth   *C.Synth // allocated separately, so the memory passed to C holds no Go pointers
+	cpuLoad  sointu.CPULoad
+	bytecode *vm.Bytecode // tells which operands hold the parameters set by SetParameter
 }
 
 func (s NativeSynther) Name() string                 { return "Native" }
 func (s NativeSynther) SupportsMultithreading() bool { return false }
+func (s NativeSynther) SupportsOversampling() bool   { return false }
 
 func (s NativeSynther) Synth(patch sointu.Patch, bpm int) (sointu.Synth, error) {
 	synth, err := Synth(patch, bpm)
@@ -45,12 +49,18 @@ func Synth(patch sointu.Patch, bpm int) (*NativeSynth, error) {
 	if len(comPatch.Operands) > 16384 { // TODO: 16384 could probably be pulled automatically from cgo
 		return nil, errors.New("bridge supports at most 16384 operands; the compiled patch has more")
 	}
+	if len(comPatch.DelayTimes) > 768 { // TODO: 768 could probably be pulled automatically from cgo
+		return nil, errors.New("bridge supports at most 768 delay times; the compiled patch has more")
+	}
+	if len(comPatch.Wavetables) > vm.MAX_WAVETABLE_SAMPLES {
+		return nil, errors.New("bridge supports at most 65536 wavetable samples; the compiled patch has more")
+	}
 	// if the patch is empty, we still need to initialize the synth with a single opcode
 	if len(comPatch.Opcodes) == 0 {
 		s.Opcodes[0] = 0
 		s.NumVoices = 1
 		s.Polyphony = 0
-		return &NativeSynth{csynth: *s}, nil
+		return &NativeSynth{csynth: s, bytecode: comPatch}, nil
 	}
 	for i, v := range comPatch.Opcodes {
 		s.Opcodes[i] = (C.uchar)(v)
@@ -61,6 +71,7 @@ func Synth(patch sointu.Patch, bpm int) (*NativeSynth, error) {
 	for i, v := range comPatch.DelayTimes {
 		s.DelayTimes[i] = (C.ushort)(v)
 	}
+	setWavetables(s, comPatch.Wavetables)
 	for i, v := range comPatch.SampleOffsets {
 		s.SampleOffsets[i].Start = (C.uint)(v.Start)
 		s.SampleOffsets[i].LoopStart = (C.ushort)(v.LoopStart)
@@ -69,10 +80,25 @@ func Synth(patch sointu.Patch, bpm int) (*NativeSynth, error) {
 	s.NumVoices = C.uint(comPatch.NumVoices)
 	s.Polyphony = C.uint(comPatch.PolyphonyBitmask)
 	s.RandSeed = 1
-	return &NativeSynth{csynth: *s}, nil
+	return &NativeSynth{csynth: s, bytecode: comPatch}, nil
+}
+
+func (s *NativeSynth) Close() {
+	setWavetables(s.csynth, nil)
 }
 
-func (s *NativeSynth) Close() {}
+// setWavetables copies the wavetable samples to memory allocated from C, as
+// the synth only has a pointer to them. The memory is allocated only when the
+// patch has wavetables.
+func setWavetables(s *C.Synth, wavetables []uint16) {
+	C.free(unsafe.Pointer(s.Wavetables))
+	s.Wavetables = nil
+	if len(wavetables) == 0 {
+		return
+	}
+	s.Wavetables = (*C.ushort)(C.malloc(C.size_t(len(wavetables) * 2)))
+	copy(unsafe.Slice((*uint16)(unsafe.Pointer(s.Wavetables)), len(wavetables)), wavetables)
+}
 
 func (s *NativeSynth) CPULoad(loads []sointu.CPULoad) int {
 	if len(loads) < 1 {
@@ -104,7 +130,7 @@ func (s *NativeSynth) CPULoad(loads []sointu.CPULoad) int {
 // exit condition would fire when the time is already past maxtime.
 // Under no conditions, nsamples >= len(buffer)/2 i.e. guaranteed to never overwrite the buffer.
 func (bridgesynth *NativeSynth) Render(buffer sointu.AudioBuffer, maxtime int) (int, int, error) {
-	synth := &bridgesynth.csynth
+	synth := bridgesynth.csynth
 	// TODO: syncBuffer is not getting passed to cgo; do we want to even try to support the syncing with the native bridge
 	if len(buffer)%1 == 1 {
 		return -1, -1, errors.New("RenderTime writes stereo signals, so buffer should have even length")
@@ -122,7 +148,7 @@ func (bridgesynth *NativeSynth) Render(buffer sointu.AudioBuffer, maxtime int) (
 
 // Trigger is part of C.Synths' implementation of sointu.Synth interface
 func (bridgesynth *NativeSynth) Trigger(voice int, note byte) {
-	s := &bridgesynth.csynth
+	s := bridgesynth.csynth
 	if voice < 0 || voice >= len(s.SynthWrk.Voices) {
 		return
 	}
@@ -133,16 +159,28 @@ func (bridgesynth *NativeSynth) Trigger(voice int, note byte) {
 
 // Release is part of C.Synths' implementation of sointu.Synth interface
 func (bridgesynth *NativeSynth) Release(voice int) {
-	s := &bridgesynth.csynth
+	s := bridgesynth.csynth
 	if voice < 0 || voice >= len(s.SynthWrk.Voices) {
 		return
 	}
 	s.SynthWrk.Voices[voice].Sustain = 0
 }
 
+// SetParameter is part of C.Synths' implementation of sointu.Synth interface
+func (bridgesynth *NativeSynth) SetParameter(target sointu.AutomationTarget, value int) {
+	for _, o := range bridgesynth.bytecode.ParameterOperands(target) {
+		bridgesynth.csynth.Operands[o] = C.uchar(value)
+	}
+}
+
+// SetSongTime is part of C.Synths' implementation of sointu.Synth interface
+func (bridgesynth *NativeSynth) SetSongTime(time int) {
+	bridgesynth.csynth.SongTick = C.uint(time)
+}
+
 // Update
 func (bridgesynth *NativeSynth) Update(patch sointu.Patch, bpm int) error {
-	s := &bridgesynth.csynth
+	s := bridgesynth.csynth
 	if n := patch.NumDelayLines(); n > 128 {
 		return fmt.Errorf("native bridge has currently a hard limit of 128 delaylines; patch uses %v", n)
 	}
@@ -156,6 +194,13 @@ func (bridgesynth *NativeSynth) Update(patch sointu.Patch, bpm int) error {
 	if len(comPatch.Operands) > 16384 { // TODO: 16384 could probably be pulled automatically from cgo
 		return errors.New("bridge supports at most 16384 operands; the compiled patch has more")
 	}
+	if len(comPatch.DelayTimes) > 768 { // TODO: 768 could probably be pulled automatically from cgo
+		return errors.New("bridge supports at most 768 delay times; the compiled patch has more")
+	}
+	if len(comPatch.Wavetables) > vm.MAX_WAVETABLE_SAMPLES {
+		return errors.New("bridge supports at most 65536 wavetable samples; the compiled patch has more")
+	}
+	bridgesynth.bytecode = comPatch
 	// if the patch is empty, we still need to initialize the synth with a single opcode
 	if len(comPatch.Opcodes) == 0 {
 		s.Opcodes[0] = 0
@@ -176,6 +221,7 @@ func (bridgesynth *NativeSynth) Update(patch sointu.Patch, bpm int) error {
 	for i, v := range comPatch.DelayTimes {
 		s.DelayTimes[i] = (C.ushort)(v)
 	}
+	setWavetables(s, comPatch.Wavetables)
 	for i, v := range comPatch.SampleOffsets {
 		s.SampleOffsets[i].Start = (C.uint)(v.Start)
 		s.SampleOffsets[i].LoopStart = (C.ushort)(v.LoopStart)
@@ -3,6 +3,7 @@ package compiler
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"text/template"
@@ -18,6 +19,10 @@ type Compiler struct {
 	Arch        string
 	Output16Bit bool
 	RowSync     bool
+	// TransposePatterns enables storing patterns that are transposed versions
+	// of each other only once, with a transpose for each pattern in the order
+	// list. Saves bytes if the song repeats the same riffs transposed.
+	TransposePatterns bool
 }
 
 //go:embed templates/amd64-386/* templates/wasm/*
@@ -85,13 +90,27 @@ func (com *Compiler) Song(song *sointu.Song) (map[string]string, error) {
 	} else if com.Arch == "wasm" {
 		templates = []string{"player.wat"}
 	}
+	if err := checkOversampling(song.Patch); err != nil {
+		return nil, err
+	}
 	features := vm.NecessaryFeaturesFor(song.Patch)
 	retmap := map[string]string{}
 	encodedPatch, err := vm.NewBytecode(song.Patch, features, song.BPM)
 	if err != nil {
 		return nil, fmt.Errorf(`could not encode patch: %v`, err)
 	}
-	patterns, sequences, err := ConstructPatterns(song)
+	lanes := encodedPatch.LaneTable(song.Patch, song.Score)
+	voiced, encoded := splitLanes(song, lanes) // the lanes are read from the patterns after the other tracks
+	if len(voiced.Score.Tracks) == 0 {
+		return nil, errors.New("the song should have at least one track that is not an automation lane")
+	}
+	song = &voiced
+	var patterns, sequences, transposes [][]byte
+	if com.TransposePatterns {
+		patterns, sequences, transposes, err = ConstructTransposedPatterns(&encoded)
+	} else {
+		patterns, sequences, err = ConstructPatterns(&encoded)
+	}
 	if err != nil {
 		return nil, fmt.Errorf(`could not encode song: %v`, err)
 	}
@@ -111,10 +130,12 @@ func (com *Compiler) Song(song *sointu.Song) (map[string]string, error) {
 				*vm.Bytecode
 				Patterns       [][]byte
 				Sequences      [][]byte
+				Transposes     [][]byte
+				Lanes          []vm.Lane
 				PatternLength  int
 				SequenceLength int
 				Hold           int
-			}{compilerMacros, featureSetMacros, x86Macros, songMacros, encodedPatch, patterns, sequences, len(patterns[0]), len(sequences[0]), 1}
+			}{compilerMacros, featureSetMacros, x86Macros, songMacros, encodedPatch, patterns, sequences, transposes, lanes, len(patterns[0]), len(sequences[0]), 1}
 			populatedTemplate, extension, err = com.compile(templateName, &data)
 		} else if com.Arch == "wasm" {
 			wasmMacros := *NewWasmMacros()
@@ -126,10 +147,12 @@ func (com *Compiler) Song(song *sointu.Song) (map[string]string, error) {
 				*vm.Bytecode
 				Patterns       [][]byte
 				Sequences      [][]byte
+				Transposes     [][]byte
+				Lanes          []vm.Lane
 				PatternLength  int
 				SequenceLength int
 				Hold           int
-			}{compilerMacros, featureSetMacros, wasmMacros, songMacros, encodedPatch, patterns, sequences, len(patterns[0]), len(sequences[0]), 1}
+			}{compilerMacros, featureSetMacros, wasmMacros, songMacros, encodedPatch, patterns, sequences, transposes, lanes, len(patterns[0]), len(sequences[0]), 1}
 			populatedTemplate, extension, err = com.compile(templateName, &data)
 		}
 		if err != nil {
@@ -140,6 +163,18 @@ func (com *Compiler) Song(song *sointu.Song) (map[string]string, error) {
 	return retmap, nil
 }
 
+// checkOversampling returns an error if an instrument of the patch is
+// oversampled, as the compiled players do not support oversampling and the
+// song would sound different than in the tracker.
+func checkOversampling(patch sointu.Patch) error {
+	for i, instr := range patch {
+		if instr.Oversampling > 1 {
+			return fmt.Errorf("%v is oversampled %vx, but the compiled players do not support oversampling", instrName(patch, i), instr.Oversampling)
+		}
+	}
+	return nil
+}
+
 func (com *Compiler) compile(templateName string, data interface{}) (string, string, error) {
 	result := bytes.NewBufferString("")
 	err := com.Template.ExecuteTemplate(result, templateName, data)
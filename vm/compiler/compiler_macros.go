@@ -2,17 +2,28 @@ package compiler
 
 import (
 	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/vm"
 )
 
 type CompilerMacros struct {
 	Clip    bool
 	Library bool
 
-	Sine   int // TODO: how can we elegantly access global constants in template, without wrapping each one by one
-	Trisaw int
-	Pulse  int
-	Gate   int
-	Sample int
+	Sine     int // TODO: how can we elegantly access global constants in template, without wrapping each one by one
+	Trisaw   int
+	Pulse    int
+	Gate     int
+	Sample   int
+	TrisawAA int
+	PulseAA  int
+
+	MathAbs    int
+	MathSign   int
+	MathTanh   int
+	MathSquare int
+	MathSqrt   int
+
+	FormantTable []uint16
 	Compiler
 }
 
@@ -23,6 +34,16 @@ func NewCompilerMacros(c Compiler) *CompilerMacros {
 		Pulse:    sointu.Pulse,
 		Gate:     sointu.Gate,
 		Sample:   sointu.Sample,
-		Compiler: c,
+		TrisawAA: sointu.TrisawAA,
+		PulseAA:  sointu.PulseAA,
+
+		MathAbs:    sointu.MathAbs,
+		MathSign:   sointu.MathSign,
+		MathTanh:   sointu.MathTanh,
+		MathSquare: sointu.MathSquare,
+		MathSqrt:   sointu.MathSqrt,
+
+		FormantTable: vm.FormantTable,
+		Compiler:     c,
 	}
 }
@@ -0,0 +1,329 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vsariola/sointu"
+)
+
+// optimizationPass modifies the song in place and returns human readable
+// descriptions of what it changed.
+type optimizationPass func(song *sointu.Song) []string
+
+// optimizationPasses are run in this order; later passes benefit from the
+// earlier ones, e.g. removing muted instruments may leave their IDs
+// unreferenced.
+//
+// Identical delay tables do not need a pass of their own: the delay time table
+// of the bytecode is already constructed so that delay units with the same
+// delay times (or delay times overlapping each other) share the table entries.
+var optimizationPasses = []optimizationPass{
+	removeDisabledUnits,
+	clearMutedInstruments,
+	clearSilentInstruments,
+	removeEmptyInstruments,
+	removeOversampling,
+	removeUnusedLanes,
+	removeSilentTracks,
+	removeUnreferencedIDs,
+	foldConstants,
+}
+
+// Optimize returns a copy of the song, with the patch and score simplified so
+// that the compiled player becomes smaller. Optimize removes disabled units;
+// instruments that are muted or that cannot be heard, along with the tracks
+// playing them; automation lanes that never set their parameter; trailing
+// tracks that never trigger a note; unit IDs that no send or automation lane
+// targets; and folds loadval followed by gain or invgain into a single
+// loadval, when it can be done exactly. The oversampling of the instruments is
+// removed, as the compiled players do not support it. Except for the muted and
+// oversampled instruments, the song should sound identical after the
+// optimization. The second return value describes what was removed or
+// changed.
+func Optimize(song *sointu.Song) (sointu.Song, []string) {
+	ret := song.Copy()
+	var report []string
+	for _, pass := range optimizationPasses {
+		report = append(report, pass(&ret)...)
+	}
+	return ret, report
+}
+
+func removeDisabledUnits(song *sointu.Song) (report []string) {
+	for i := range song.Patch {
+		instr := &song.Patch[i]
+		units := instr.Units[:0]
+		for _, unit := range instr.Units {
+			if unit.Type != "" && !unit.Disabled {
+				units = append(units, unit)
+			}
+		}
+		if removed := len(instr.Units) - len(units); removed > 0 {
+			report = append(report, fmt.Sprintf("%v: removed %v disabled or empty units", instrName(song.Patch, i), removed))
+		}
+		instr.Units = units
+	}
+	return
+}
+
+func clearMutedInstruments(song *sointu.Song) (report []string) {
+	for i := range song.Patch {
+		instr := &song.Patch[i]
+		if instr.Mute && len(instr.Units) > 0 {
+			report = append(report, fmt.Sprintf("%v: muted, removed its %v units", instrName(song.Patch, i), len(instr.Units)))
+			instr.Units = nil
+		}
+	}
+	return
+}
+
+// clearSilentInstruments removes all units from instruments that have no
+// effect on the output: they do not output sound or aux signals, do not
+// consume aux signals, do not output syncs, do not change the speed and do not
+// send to other instruments. Sends targeting the removed units are removed too,
+// which may render further instruments silent, so this is repeated until
+// nothing changes.
+func clearSilentInstruments(song *sointu.Song) (report []string) {
+	for changed := true; changed; {
+		changed = false
+		for i := range song.Patch {
+			instr := &song.Patch[i]
+			if len(instr.Units) == 0 || hasEffect(song.Patch, i) {
+				continue
+			}
+			report = append(report, fmt.Sprintf("%v: cannot be heard, removed its %v units", instrName(song.Patch, i), len(instr.Units)))
+			instr.Units = nil
+			changed = true
+		}
+		for i := range song.Patch {
+			instr := &song.Patch[i]
+			units := instr.Units[:0]
+			for _, unit := range instr.Units {
+				if unit.Type == "send" {
+					if _, _, err := song.Patch.FindUnit(unit.Parameters["target"]); err != nil {
+						report = append(report, fmt.Sprintf("%v: removed send to missing unit id %v", instrName(song.Patch, i), unit.Parameters["target"]))
+						changed = true
+						if unit.Parameters["sendpop"] == 1 {
+							// the send still needs to pop the signal of the stack
+							units = append(units, sointu.Unit{Type: "pop", Parameters: sointu.ParamMap{"stereo": unit.Parameters["stereo"]}})
+						}
+						continue
+					}
+				}
+				units = append(units, unit)
+			}
+			instr.Units = units
+		}
+	}
+	return
+}
+
+func hasEffect(patch sointu.Patch, instrIndex int) bool {
+	for _, unit := range patch[instrIndex].Units {
+		switch unit.Type {
+		case "out", "outaux", "aux", "in", "sync", "speed":
+			return true
+		case "send":
+			if i, _, err := patch.FindUnit(unit.Parameters["target"]); err == nil && i != instrIndex {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeEmptyInstruments removes instruments with no units, along with the
+// tracks triggering their voices. This is only possible if the voices of the
+// instrument are played by tracks that play no other instruments; otherwise,
+// the voices of the remaining tracks would end up on wrong instruments. At
+// least one track that is not an automation lane is always kept. Automation
+// lanes between the removed tracks are kept; the lanes targeting the removed
+// units are removed later by removeUnusedLanes.
+func removeEmptyInstruments(song *sointu.Song) (report []string) {
+	for i := len(song.Patch) - 1; i >= 0; i-- {
+		if len(song.Patch[i].Units) > 0 {
+			continue
+		}
+		start := song.Patch.FirstVoiceForInstrument(i)
+		end := min(start+song.Patch[i].NumVoices, song.Score.NumVoices())
+		firstTrack, lastTrack := -1, -1
+		if start < end {
+			for t := range song.Score.Tracks {
+				if song.Score.Tracks[t].IsAutomation() {
+					continue // the lanes have no voices
+				}
+				v := song.Score.FirstVoiceForTrack(t)
+				if v == start {
+					firstTrack = t
+				}
+				if v+song.Score.Tracks[t].NumVoices == end {
+					lastTrack = t
+				}
+			}
+			if firstTrack < 0 || lastTrack < 0 {
+				continue
+			}
+			isVoiced := func(t sointu.Track) bool { return !t.IsAutomation() }
+			if !slices.ContainsFunc(song.Score.Tracks[:firstTrack], isVoiced) && !slices.ContainsFunc(song.Score.Tracks[lastTrack+1:], isVoiced) {
+				continue // removing the tracks would leave only automation lanes
+			}
+			tracks := slices.DeleteFunc(slices.Clone(song.Score.Tracks[firstTrack:lastTrack+1]), isVoiced)
+			song.Score.Tracks = slices.Replace(song.Score.Tracks, firstTrack, lastTrack+1, tracks...)
+		}
+		msg := fmt.Sprintf("removed empty instrument %v", instrName(song.Patch, i))
+		if firstTrack == lastTrack && firstTrack >= 0 {
+			msg += fmt.Sprintf(" and track %v", firstTrack)
+		} else if firstTrack >= 0 {
+			msg += fmt.Sprintf(" and tracks %v-%v", firstTrack, lastTrack)
+		}
+		report = append(report, msg)
+		song.Patch = append(song.Patch[:i], song.Patch[i+1:]...)
+	}
+	return
+}
+
+func removeOversampling(song *sointu.Song) (report []string) {
+	for i := range song.Patch {
+		if o := song.Patch[i].Oversampling; o > 1 {
+			song.Patch[i].Oversampling = 0
+			report = append(report, fmt.Sprintf("%v: removed %vx oversampling, which the compiled players do not support", instrName(song.Patch, i), o))
+		}
+	}
+	return
+}
+
+// removeUnusedLanes removes the automation lanes that never set their
+// parameter, or whose parameter cannot be found, e.g. because the targeted
+// unit was removed. The lanes have no voices, so they can be removed from
+// anywhere in the score.
+func removeUnusedLanes(song *sointu.Song) (report []string) {
+	for t := len(song.Score.Tracks) - 1; t >= 0; t-- {
+		track := song.Score.Tracks[t]
+		if !track.IsAutomation() {
+			continue
+		}
+		if _, _, _, ok := song.Patch.FindAutomationParam(track.Automation); ok && !isSilent(song.Score, track) {
+			continue
+		}
+		report = append(report, fmt.Sprintf("removed automation lane %v: never sets a parameter", t))
+		song.Score.Tracks = slices.Delete(song.Score.Tracks, t, t+1)
+	}
+	return
+}
+
+// removeSilentTracks removes tracks that never trigger a note. Only the last
+// of the tracks that are not automation lanes can be removed, as removing a
+// track from the middle would shift the voices of the tracks after it. The
+// voices themselves stay in the patch, as an instrument can make sound without
+// ever being triggered. At least one track is always kept.
+func removeSilentTracks(song *sointu.Song) (report []string) {
+	for {
+		voiced, last := 0, -1
+		for t, track := range song.Score.Tracks {
+			if !track.IsAutomation() {
+				voiced++
+				last = t
+			}
+		}
+		if voiced <= 1 || !isSilent(song.Score, song.Score.Tracks[last]) {
+			return
+		}
+		report = append(report, fmt.Sprintf("removed track %v: never plays a note", last))
+		song.Score.Tracks = slices.Delete(song.Score.Tracks, last, last+1)
+	}
+}
+
+// isSilent returns true if the track never has a value other than hold or
+// release.
+func isSilent(score sointu.Score, track sointu.Track) bool {
+	for row := 0; row < score.LengthInRows(); row++ {
+		if track.Note(score.SongPos(row)) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func removeUnreferencedIDs(song *sointu.Song) (report []string) {
+	targets := map[int]bool{}
+	for _, track := range song.Score.Tracks {
+		targets[track.Automation.UnitID] = true
+	}
+	for _, instr := range song.Patch {
+		for _, unit := range instr.Units {
+			if unit.Type == "send" {
+				targets[unit.Parameters["target"]] = true
+			}
+		}
+	}
+	removed := 0
+	for i := range song.Patch {
+		for u := range song.Patch[i].Units {
+			if unit := &song.Patch[i].Units[u]; unit.ID != 0 && !targets[unit.ID] {
+				unit.ID = 0
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		report = append(report, fmt.Sprintf("removed %v unreferenced unit IDs", removed))
+	}
+	return
+}
+
+// foldConstants folds a loadval followed by a gain or invgain into a single
+// loadval. Both units need to have the same stereo setting and they cannot be
+// targeted by sends. Only done when the folded value is an integer, so that
+// the result is exactly the same.
+func foldConstants(song *sointu.Song) (report []string) {
+	for i := range song.Patch {
+		units := song.Patch[i].Units
+		for u := 0; u+1 < len(units); {
+			load, next := units[u], units[u+1]
+			if load.Type != "loadval" || load.ID != 0 || next.ID != 0 || load.Parameters["stereo"] != next.Parameters["stereo"] {
+				u++
+				continue
+			}
+			value, ok := foldedValue(load, next)
+			if !ok {
+				u++
+				continue
+			}
+			report = append(report, fmt.Sprintf("%v: folded %v of unit %v into loadval", instrName(song.Patch, i), next.Type, u+1))
+			units[u].Parameters["value"] = value
+			units = append(units[:u+1], units[u+2:]...)
+		}
+		song.Patch[i].Units = units
+	}
+	return
+}
+
+// foldedValue returns the value of a loadval that results in exactly the same
+// signal as the loadval followed by the gain or invgain unit.
+func foldedValue(load, next sointu.Unit) (int, bool) {
+	d := load.Parameters["value"] - 64
+	switch next.Type {
+	case "gain":
+		d *= next.Parameters["gain"]
+	case "invgain":
+		g := next.Parameters["invgain"]
+		if g == 0 || d*128%g != 0 {
+			return 0, false
+		}
+		d = d * 128 / g * 128
+	default:
+		return 0, false
+	}
+	if d%128 != 0 || d < -64*128 || d > 64*128 {
+		return 0, false
+	}
+	return 64 + d/128, true
+}
+
+func instrName(patch sointu.Patch, i int) string {
+	if patch[i].Name != "" {
+		return patch[i].Name
+	}
+	return fmt.Sprintf("instr %v", i)
+}
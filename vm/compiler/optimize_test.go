@@ -0,0 +1,155 @@
+package compiler_test
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/vm"
+	"github.com/vsariola/sointu/vm/compiler"
+	"gopkg.in/yaml.v3"
+)
+
+func TestOptimizeRegressionSongs(t *testing.T) {
+	_, myname, _, _ := runtime.Caller(0)
+	files, err := filepath.Glob(path.Join(path.Dir(myname), "..", "..", "tests", "*.yml"))
+	if err != nil {
+		t.Fatalf("cannot glob files in the test directory: %v", err)
+	}
+	for _, filename := range files {
+		basename := filepath.Base(filename)
+		testname := strings.TrimSuffix(basename, path.Ext(basename))
+		t.Run(testname, func(t *testing.T) {
+			if runtime.GOOS != "windows" && strings.Contains(testname, "sample") {
+				t.Skip("Samples (gm.dls) available only on Windows")
+				return
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("cannot read the .yml file: %v", filename)
+			}
+			var song sointu.Song
+			if err := yaml.Unmarshal(data, &song); err != nil {
+				t.Fatalf("could not parse the .yml file: %v", err)
+			}
+			optimized, _ := compiler.Optimize(&song)
+			expected, err := sointu.Play(vm.GoSynther{}, song, nil)
+			if err != nil {
+				t.Fatalf("Play failed: %v", err)
+			}
+			actual, err := sointu.Play(vm.GoSynther{}, optimized, nil)
+			if err != nil {
+				t.Fatalf("Play of the optimized song failed: %v", err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("the optimized song does not sound identical to the original")
+			}
+		})
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	out := sointu.Unit{Type: "out", Parameters: sointu.ParamMap{"stereo": 0, "gain": 64}}
+	song := sointu.Song{
+		BPM:         100,
+		RowsPerBeat: 4,
+		Score: sointu.Score{
+			Length:         1,
+			RowsPerPattern: 4,
+			Tracks: []sointu.Track{
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 0, 0}}},
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 0, 0}}},
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{0, 1, 1, 1}}},
+			},
+		},
+		Patch: sointu.Patch{
+			{Name: "Lead", NumVoices: 1, Units: []sointu.Unit{
+				{Type: "loadval", ID: 1, Parameters: sointu.ParamMap{"stereo": 0, "value": 128}},
+				{Type: "gain", Parameters: sointu.ParamMap{"stereo": 0, "gain": 32}},
+				{Type: "envelope", Disabled: true, Parameters: sointu.ParamMap{"stereo": 0, "attack": 64, "decay": 64, "sustain": 64, "release": 64, "gain": 64}},
+				out,
+			}},
+			{Name: "Muted", NumVoices: 1, Mute: true, Units: []sointu.Unit{
+				{Type: "loadval", Parameters: sointu.ParamMap{"stereo": 0, "value": 96}},
+				out,
+			}},
+			{Name: "Pad", NumVoices: 1, Units: []sointu.Unit{
+				{Type: "loadval", Parameters: sointu.ParamMap{"stereo": 0, "value": 96}},
+				out,
+			}},
+		},
+	}
+	optimized, report := compiler.Optimize(&song)
+	if len(report) == 0 {
+		t.Fatalf("expected Optimize to report what was removed")
+	}
+	if len(optimized.Patch) != 2 || optimized.Patch[0].Name != "Lead" || optimized.Patch[1].Name != "Pad" {
+		t.Fatalf("expected the muted instrument to be removed, got %v instruments", len(optimized.Patch))
+	}
+	if len(optimized.Score.Tracks) != 1 {
+		t.Fatalf("expected the tracks of the muted instrument and the silent track to be removed, got %v tracks", len(optimized.Score.Tracks))
+	}
+	if units := optimized.Patch[0].Units; len(units) != 2 || units[0].Type != "loadval" || units[0].ID != 0 || units[0].Parameters["value"] != 80 || units[1].Type != "out" {
+		t.Fatalf("expected loadval with value 80 followed by out, got %v", units)
+	}
+	if len(song.Patch) != 3 || len(song.Patch[0].Units) != 4 {
+		t.Fatalf("Optimize should not modify the original song")
+	}
+}
+
+func TestOptimizeLanes(t *testing.T) {
+	out := sointu.Unit{Type: "out", Parameters: sointu.ParamMap{"stereo": 0, "gain": 64}}
+	lane := func(id int) sointu.Track {
+		return sointu.Track{Automation: sointu.AutomationTarget{UnitID: id}, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{96, 1, 0, 0}}}
+	}
+	song := sointu.Song{
+		BPM:         100,
+		RowsPerBeat: 4,
+		Score: sointu.Score{
+			Length:         1,
+			RowsPerPattern: 4,
+			Tracks: []sointu.Track{
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 0, 0}}},
+				lane(2),
+				lane(1),
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 0, 0}}},
+				{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 0, 0}}},
+			},
+		},
+		Patch: sointu.Patch{
+			{Name: "Muted", NumVoices: 2, Mute: true, Units: []sointu.Unit{
+				{Type: "loadval", ID: 1, Parameters: sointu.ParamMap{"stereo": 0, "value": 96}},
+				out,
+			}},
+			{Name: "Lead", NumVoices: 1, Units: []sointu.Unit{
+				{Type: "loadval", ID: 2, Parameters: sointu.ParamMap{"stereo": 0, "value": 64}},
+				out,
+			}},
+		},
+	}
+	optimized, _ := compiler.Optimize(&song)
+	// the lane between the tracks of the muted instrument is kept, but the
+	// lane targeting the removed unit is removed
+	if tracks := optimized.Score.Tracks; len(tracks) != 2 || tracks[0].Automation.UnitID != 2 || tracks[1].IsAutomation() {
+		t.Fatalf("expected the lane of Lead and the track of Lead to remain, got %v", tracks)
+	}
+	if units := optimized.Patch[0].Units; len(optimized.Patch) != 1 || units[0].ID != 2 {
+		t.Fatalf("expected the unit targeted by the lane to keep its ID, got %v", optimized.Patch)
+	}
+	// when only automation lanes would remain, the tracks are not removed
+	song.Score.Tracks = []sointu.Track{song.Score.Tracks[0], lane(2)}
+	song.Patch[0].NumVoices = 1
+	optimized, _ = compiler.Optimize(&song)
+	if !slices.ContainsFunc(optimized.Score.Tracks, func(t sointu.Track) bool { return !t.IsAutomation() }) {
+		t.Fatalf("expected at least one track that is not an automation lane to remain, got %v", optimized.Score.Tracks)
+	}
+	if err := optimized.Validate(); err != nil {
+		t.Fatalf("the optimized song is not valid: %v", err)
+	}
+}
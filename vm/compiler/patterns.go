@@ -3,8 +3,10 @@ package compiler
 import (
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/vm"
 )
 
 // flattenSequence returns the notes of a track in a single linear array of
@@ -81,43 +83,36 @@ func splitSequence(sequence []int, patternLength int) [][]int {
 // sequence of indices of each added pattern in the updated pattern table & the
 // updated pattern table.
 func addPatternsToTable(patterns [][]int, table [][]int) ([]int, [][]int) {
+	sequence, _, updatedTable := addTransposedPatternsToTable(patterns, table, false)
+	return sequence, updatedTable
+}
+
+// addTransposedPatternsToTable works like addPatternsToTable, but if transpose
+// is true, an existing pattern is reused also when the added pattern is the
+// existing pattern transposed. In addition to the sequence and the updated
+// table, it returns the transpose of each added pattern i.e. the number that
+// should be added to all the notes (> 1) of the pattern in the table.
+func addTransposedPatternsToTable(patterns [][]int, table [][]int, transpose bool) ([]int, []int, [][]int) {
 	updatedTable := make([][]int, len(table))
 	copy(updatedTable, table) // avoid updating the underlying slices for concurrency safety
 	sequence := make([]int, len(patterns))
+	transposes := make([]int, len(patterns))
 	for i, pat := range patterns {
 		// go through the current pattern table to see if there's already a
 		// pattern that could be used
 		patternIndex := -1
 		for j, p := range updatedTable {
-			match := true
-			identical := true
-			for k, n := range p {
-				if (n > -1 && pat[k] > -1 && n != pat[k]) ||
-					(n == -1 && pat[k] > 1) ||
-					(n > 1 && pat[k] == -1) {
-					match = false
-					break
-				}
-				if (i < len(pat) && n != pat[i]) || n != 1 {
-					identical = false
-				}
+			t := 0
+			if transpose {
+				t = transposeBetween(p, pat)
 			}
-			if match {
-				if !identical {
-					// the patterns were not identical; one of them had don't
-					// cares where another had hold or release so we make a new
-					// copy with merged data, that essentially is a max of the
-					// two patterns
-					mergedPat := make([]int, len(p))
-					copy(mergedPat, p) // make a copy instead of updating existing, for concurrency safety
-					for k, n := range pat {
-						if n != -1 {
-							mergedPat[k] = n
-						}
-					}
-					updatedTable[j] = mergedPat
-				}
-				patternIndex = j
+			shifted, ok := transposePattern(pat, -t)
+			if !ok {
+				continue
+			}
+			if merged, ok := mergePatterns(p, shifted); ok {
+				updatedTable[j] = merged
+				patternIndex, transposes[i] = j, t
 				break
 			}
 		}
@@ -127,7 +122,60 @@ func addPatternsToTable(patterns [][]int, table [][]int) ([]int, [][]int) {
 		}
 		sequence[i] = patternIndex
 	}
-	return sequence, updatedTable
+	return sequence, transposes, updatedTable
+}
+
+// mergePatterns checks if the two patterns match, taking don't cares into
+// account, and if so, returns a new pattern that has the notes, holds and
+// releases of both, essentially a max of the two patterns.
+func mergePatterns(p, pat []int) ([]int, bool) {
+	for k, n := range p {
+		if (n > -1 && pat[k] > -1 && n != pat[k]) ||
+			(n == -1 && pat[k] > 1) ||
+			(n > 1 && pat[k] == -1) {
+			return nil, false
+		}
+	}
+	mergedPat := make([]int, len(p))
+	copy(mergedPat, p) // make a copy instead of updating existing, for concurrency safety
+	for k, n := range pat {
+		if n != -1 {
+			mergedPat[k] = n
+		}
+	}
+	return mergedPat, true
+}
+
+// transposeBetween returns how much the first note of pattern pat is higher
+// than the note at the same row in pattern p. Returns 0 if pat has no notes or
+// p has no note at that row.
+func transposeBetween(p, pat []int) int {
+	for k, n := range pat {
+		if n > 1 {
+			if p[k] > 1 {
+				return n - p[k]
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// transposePattern returns a copy of the pattern with all the notes (> 1)
+// transposed by the given amount. Returns false if a transposed note would end
+// up outside 2 .. 255.
+func transposePattern(pat []int, amount int) ([]int, bool) {
+	ret := make([]int, len(pat))
+	for k, n := range pat {
+		if n > 1 {
+			n += amount
+			if n < 2 || n > 255 {
+				return nil, false
+			}
+		}
+		ret[k] = n
+	}
+	return ret, true
 }
 
 func intsToBytes(array []int) ([]byte, error) {
@@ -141,20 +189,71 @@ func intsToBytes(array []int) ([]byte, error) {
 	return ret, nil
 }
 
+// splitLanes returns a copy of the song without the automation lanes, and a
+// copy where the lanes are placed after the other tracks, once for each entry
+// of the lane table, as the players read them from the patterns. The values in
+// the lanes are clamped to the maximum value of the parameter, so the players
+// can write them to the operands as they are.
+func splitLanes(song *sointu.Song, lanes []vm.Lane) (voiced, encoded sointu.Song) {
+	voiced = *song
+	voiced.Score.Tracks = nil
+	for _, t := range song.Score.Tracks {
+		if !t.IsAutomation() {
+			voiced.Score.Tracks = append(voiced.Score.Tracks, t)
+		}
+	}
+	encoded = voiced
+	encoded.Score.Tracks = slices.Clone(voiced.Score.Tracks)
+	for _, l := range lanes {
+		t := song.Score.Tracks[l.Track].Copy()
+		_, _, param, _ := song.Patch.FindAutomationParam(t.Automation)
+		for _, pat := range t.Patterns {
+			for i, v := range pat {
+				if v > 1 {
+					pat[i] = byte(min(int(v), param.MaxValue))
+				}
+			}
+		}
+		encoded.Score.Tracks = append(encoded.Score.Tracks, t)
+	}
+	return voiced, encoded
+}
+
+// ConstructPatterns encodes the score of the song into a pattern table and
+// sequences of pattern indices, one sequence per track. Identical patterns are
+// stored only once.
 func ConstructPatterns(song *sointu.Song) ([][]byte, [][]byte, error) {
+	patterns, sequences, _, err := constructPatterns(song, false)
+	return patterns, sequences, err
+}
+
+// ConstructTransposedPatterns works like ConstructPatterns, but patterns that
+// are transposed versions of each other are stored only once. The returned
+// transposes have one byte for each byte in sequences; the byte should be added
+// (modulo 256) to all notes (> 1) of the pattern when playing.
+func ConstructTransposedPatterns(song *sointu.Song) (patterns, sequences, transposes [][]byte, err error) {
+	return constructPatterns(song, true)
+}
+
+func constructPatterns(song *sointu.Song, transpose bool) ([][]byte, [][]byte, [][]byte, error) {
 	sequences := make([][]byte, len(song.Score.Tracks))
+	transposes := make([][]byte, len(song.Score.Tracks))
 	var patterns [][]int
 	for i, t := range song.Score.Tracks {
 		flat := flattenSequence(t, song.Score.Length, song.Score.RowsPerPattern, true)
 		dontCares := markDontCares(flat)
 		// TODO: we could give the user the possibility to use another length during encoding that during composing
 		chunks := splitSequence(dontCares, song.Score.RowsPerPattern)
-		var sequence []int
-		sequence, patterns = addPatternsToTable(chunks, patterns)
+		var sequence, trackTransposes []int
+		sequence, trackTransposes, patterns = addTransposedPatternsToTable(chunks, patterns, transpose)
 		var err error
 		sequences[i], err = intsToBytes(sequence)
 		if err != nil {
-			return nil, nil, errors.New("the constructed pattern table would result in > 256 unique patterns; only 256 unique patterns are supported")
+			return nil, nil, nil, errors.New("the constructed pattern table would result in > 256 unique patterns; only 256 unique patterns are supported")
+		}
+		transposes[i] = make([]byte, len(trackTransposes))
+		for j, t := range trackTransposes {
+			transposes[i][j] = byte(t) // wraps around, as the player adds the transposes modulo 256
 		}
 	}
 	bytePatterns := make([][]byte, len(patterns))
@@ -163,7 +262,7 @@ func ConstructPatterns(song *sointu.Song) ([][]byte, [][]byte, error) {
 		replaceInts(pat, -1, 0) // replace don't cares with releases
 		bytePatterns[i], err = intsToBytes(pat)
 		if err != nil {
-			return nil, nil, fmt.Errorf("invalid note in pattern, notes should be 0 .. 255: %v", err)
+			return nil, nil, nil, fmt.Errorf("invalid note in pattern, notes should be 0 .. 255: %v", err)
 		}
 	}
 	allZeroIndex := -1
@@ -194,5 +293,5 @@ func ConstructPatterns(song *sointu.Song) ([][]byte, [][]byte, error) {
 			}
 		}
 	}
-	return bytePatterns, sequences, nil
+	return bytePatterns, sequences, transposes, nil
 }
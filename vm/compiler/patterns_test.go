@@ -90,3 +90,32 @@ func TestDontCares(t *testing.T) {
 		t.Fatalf("got different patterns than expected. got: %v expected: %v", patterns, expectedPatterns)
 	}
 }
+
+func TestTransposedPatterns(t *testing.T) {
+	song := sointu.Song{
+		Score: sointu.Score{
+			Length:         3,
+			RowsPerPattern: 4,
+			Tracks: []sointu.Track{{
+				Patterns: []sointu.Pattern{{64, 1, 67, 0}, {69, 1, 72, 0}, {62, 1, 65, 0}},
+				Order:    []int{0, 1, 2},
+			}},
+		},
+	}
+	patterns, sequences, transposes, err := compiler.ConstructTransposedPatterns(&song)
+	if err != nil {
+		t.Fatalf("error constructing patterns: %v", err)
+	}
+	expectedPatterns := [][]byte{{64, 1, 67, 0}}
+	expectedSequences := [][]byte{{0, 0, 0}}
+	expectedTransposes := [][]byte{{0, 5, 254}}
+	if !reflect.DeepEqual(patterns, expectedPatterns) {
+		t.Fatalf("got different patterns than expected. got: %v expected: %v", patterns, expectedPatterns)
+	}
+	if !reflect.DeepEqual(sequences, expectedSequences) {
+		t.Fatalf("got different sequences than expected. got: %v expected: %v", sequences, expectedSequences)
+	}
+	if !reflect.DeepEqual(transposes, expectedTransposes) {
+		t.Fatalf("got different transposes than expected. got: %v expected: %v", transposes, expectedTransposes)
+	}
+}
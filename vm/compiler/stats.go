@@ -0,0 +1,199 @@
+package compiler
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/vm"
+)
+
+type (
+	// Stats is a size report of a song compiled into a player. It tells which
+	// opcodes were included in the virtual machine and why, and how many
+	// bytes each of the data sections of the player take. Useful for finding
+	// out which unit or pattern should be optimized to make the song smaller.
+	Stats struct {
+		Opcodes  []OpcodeStats
+		Sections []SectionStats
+		// Transposed lists the sizes of the pattern, order and transpose
+		// sections, if the patterns were stored with transposes (see
+		// Compiler.TransposePatterns).
+		Transposed []SectionStats
+		// Warnings lists the features of the song that the compiled player
+		// does not support, e.g. oversampled instruments.
+		Warnings []string
+	}
+
+	// OpcodeStats lists all the units that caused an opcode to be included in
+	// the virtual machine.
+	OpcodeStats struct {
+		Type  string
+		Units []UnitRef
+	}
+
+	// UnitRef identifies a unit within a patch.
+	UnitRef struct {
+		Instrument     int
+		InstrumentName string
+		Unit           int
+		ID             int
+	}
+
+	// SectionStats tells the size of a data section in the compiled player, in
+	// bytes. Compressed is the size of the section when compressed on its own
+	// with deflate; the real exe packers use context modelling and compress
+	// all the sections together, so this is just a rough estimate of how well
+	// the section compresses.
+	SectionStats struct {
+		Name       string
+		Size       int
+		Compressed int
+	}
+)
+
+// NewStats compiles the song into bytecode and patterns, similarly as
+// Compiler.Song does, and reports how large the different parts are.
+func NewStats(song *sointu.Song) (*Stats, error) {
+	features := vm.NecessaryFeaturesFor(song.Patch)
+	bytecode, err := vm.NewBytecode(song.Patch, features, song.BPM)
+	if err != nil {
+		return nil, fmt.Errorf(`could not encode patch: %v`, err)
+	}
+	lanes := bytecode.LaneTable(song.Patch, song.Score)
+	_, encoded := splitLanes(song, lanes)
+	patterns, sequences, err := ConstructPatterns(&encoded)
+	if err != nil {
+		return nil, fmt.Errorf(`could not encode song: %v`, err)
+	}
+	tPatterns, tSequences, tTransposes, err := ConstructTransposedPatterns(&encoded)
+	if err != nil {
+		return nil, fmt.Errorf(`could not encode song with transposes: %v`, err)
+	}
+	ret := &Stats{}
+	for i, instr := range song.Patch {
+		if instr.Oversampling > 1 {
+			ret.Warnings = append(ret.Warnings, fmt.Sprintf("%v is oversampled %vx, but the compiled players do not support oversampling", instrName(song.Patch, i), instr.Oversampling))
+		}
+	}
+	for _, instr := range features.Instructions() {
+		ret.Opcodes = append(ret.Opcodes, OpcodeStats{Type: instr})
+	}
+	for i, instr := range song.Patch {
+		for u, unit := range instr.Units {
+			if unit.Type == "" || unit.Disabled {
+				continue
+			}
+			code, ok := features.Opcode(unit.Type)
+			if !ok {
+				continue
+			}
+			o := &ret.Opcodes[code/2-1]
+			o.Units = append(o.Units, UnitRef{Instrument: i, InstrumentName: instr.Name, Unit: u, ID: unit.ID})
+		}
+	}
+	var delayTimes, wavetables, sampleOffsets, laneTable bytes.Buffer
+	binary.Write(&delayTimes, binary.LittleEndian, bytecode.DelayTimes)
+	binary.Write(&wavetables, binary.LittleEndian, bytecode.Wavetables)
+	binary.Write(&sampleOffsets, binary.LittleEndian, bytecode.SampleOffsets)
+	for _, l := range lanes {
+		binary.Write(&laneTable, binary.LittleEndian, l.Operand)
+	}
+	for _, l := range lanes {
+		laneTable.WriteByte(l.Value)
+	}
+	ret.Sections = []SectionStats{
+		newSectionStats("opcodes", bytecode.Opcodes),
+		newSectionStats("operands", bytecode.Operands),
+		newSectionStats("patterns", bytes.Join(patterns, nil)),
+		newSectionStats("order", bytes.Join(sequences, nil)),
+		newSectionStats("delay times", delayTimes.Bytes()),
+		newSectionStats("wavetables", wavetables.Bytes()),
+		newSectionStats("sample offsets", sampleOffsets.Bytes()),
+		newSectionStats("automation lanes", laneTable.Bytes()),
+	}
+	ret.Transposed = []SectionStats{
+		newSectionStats("patterns", bytes.Join(tPatterns, nil)),
+		newSectionStats("order", bytes.Join(tSequences, nil)),
+		newSectionStats("transposes", bytes.Join(tTransposes, nil)),
+	}
+	return ret, nil
+}
+
+func newSectionStats(name string, data []byte) SectionStats {
+	ret := SectionStats{Name: name, Size: len(data)}
+	if len(data) == 0 {
+		return ret
+	}
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestCompression)
+	w.Write(data)
+	w.Close()
+	ret.Compressed = b.Len()
+	return ret
+}
+
+// Write writes the report in human readable form.
+func (s *Stats) Write(w io.Writer) error {
+	t := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, warning := range s.Warnings {
+		fmt.Fprintf(t, "WARNING: %v\n", warning)
+	}
+	if len(s.Warnings) > 0 {
+		fmt.Fprintln(t)
+	}
+	fmt.Fprintln(t, "OPCODE\tUNITS")
+	for _, o := range s.Opcodes {
+		fmt.Fprintf(t, "%v\t", o.Type)
+		for i, u := range o.Units {
+			if i > 0 {
+				fmt.Fprint(t, ", ")
+			}
+			fmt.Fprint(t, u)
+		}
+		fmt.Fprintln(t)
+	}
+	fmt.Fprintln(t)
+	fmt.Fprintln(t, "SECTION\tBYTES\tDEFLATED (EST.)")
+	total, totalCompressed := 0, 0
+	for _, sec := range s.Sections {
+		fmt.Fprintf(t, "%v\t%v\t%v\n", sec.Name, sec.Size, sec.Compressed)
+		total += sec.Size
+		totalCompressed += sec.Compressed
+	}
+	fmt.Fprintf(t, "total\t%v\t%v\n", total, totalCompressed)
+	if len(s.Transposed) > 0 {
+		// the savings are compared to the plain patterns and order sections
+		plain, plainCompressed := 0, 0
+		for _, sec := range s.Sections {
+			if sec.Name == "patterns" || sec.Name == "order" {
+				plain += sec.Size
+				plainCompressed += sec.Compressed
+			}
+		}
+		fmt.Fprintln(t)
+		fmt.Fprintln(t, "WITH TRANSPOSES\tBYTES\tDEFLATED (EST.)")
+		for _, sec := range s.Transposed {
+			fmt.Fprintf(t, "%v\t%v\t%v\n", sec.Name, sec.Size, sec.Compressed)
+			plain -= sec.Size
+			plainCompressed -= sec.Compressed
+		}
+		fmt.Fprintf(t, "savings\t%v\t%v\n", plain, plainCompressed)
+	}
+	return t.Flush()
+}
+
+func (u UnitRef) String() string {
+	name := u.InstrumentName
+	if name == "" {
+		name = fmt.Sprintf("instr %v", u.Instrument)
+	}
+	if u.ID != 0 {
+		return fmt.Sprintf("%v/unit %v (id %v)", name, u.Unit, u.ID)
+	}
+	return fmt.Sprintf("%v/unit %v", name, u.Unit)
+}
@@ -0,0 +1,47 @@
+package compiler_test
+
+import (
+	"testing"
+
+	"github.com/vsariola/sointu"
+	"github.com/vsariola/sointu/vm/compiler"
+)
+
+func TestStats(t *testing.T) {
+	song := sointu.Song{
+		BPM:         100,
+		RowsPerBeat: 4,
+		Score: sointu.Score{
+			Length:         1,
+			RowsPerPattern: 8,
+			Tracks: []sointu.Track{{
+				NumVoices: 1,
+				Patterns:  []sointu.Pattern{{64, 1, 1, 1, 0, 0, 0, 0}},
+				Order:     sointu.Order{0},
+			}},
+		},
+		Patch: sointu.Patch{{Name: "Instr", NumVoices: 1, Oversampling: 2, Units: []sointu.Unit{
+			{Type: "envelope", Parameters: map[string]int{"attack": 64, "decay": 64, "sustain": 64, "release": 64, "gain": 64}},
+			{Type: "envelope", Parameters: map[string]int{"attack": 64, "decay": 64, "sustain": 64, "release": 64, "gain": 64}},
+			{Type: "mulp", Parameters: map[string]int{}, Disabled: true},
+			{Type: "addp", Parameters: map[string]int{}},
+			{Type: "out", Parameters: map[string]int{"stereo": 0, "gain": 64}},
+		}}},
+	}
+	stats, err := compiler.NewStats(&song)
+	if err != nil {
+		t.Fatalf("NewStats failed: %v", err)
+	}
+	if len(stats.Opcodes) != 3 {
+		t.Fatalf("expected 3 opcodes, got %v", len(stats.Opcodes))
+	}
+	if o := stats.Opcodes[0]; o.Type != "envelope" || len(o.Units) != 2 || o.Units[1].Unit != 1 {
+		t.Fatalf("envelope opcode should be caused by units 0 and 1, got %v", o)
+	}
+	if s := stats.Sections[0]; s.Name != "opcodes" || s.Size != 5 { // 4 units + end of instrument
+		t.Fatalf("expected 5 bytes of opcodes, got %v", s)
+	}
+	if len(stats.Warnings) != 1 {
+		t.Fatalf("expected a warning about the oversampled instrument, got %v", stats.Warnings)
+	}
+}
@@ -197,6 +197,236 @@ su_op_filter_skipneghighpass:
     ret
 {{end}}
 
+{{- if .HasOp "formant"}}
+;-------------------------------------------------------------------------------
+;   FORMANT opcode: vowel filter, two parallel band-passes at the formants
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  r*(b1+g*b2), where b1 and b2 are the band-passed signals
+;   Stereo: l r ->  the same for both channels
+;   The formant frequencies and the gain g are interpolated from the formant
+;   table. The interpolated coefficients are kept below the stack pointer, as
+;   nothing is pushed or called after they are computed.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_formant" "Opcode"}}
+{{- if .Stereo "formant"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fld     dword [{{.Input "formant" "vowel"}}] ; v x
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]
+    fadd    st0, st0                        ; 2*v-1 x
+    {{.Call "su_clip"}}
+    fld1
+    faddp   st1, st0
+    fadd    st0, st0                        ; p x, where p=2*(clip(2*v-1)+1) is the position in the table [0,4]
+    fld     st0                             ; p p x
+    fsub    dword [{{.Float 0.5 | .Use}}]   ; p-.5 p x
+    fistp   dword [{{.SP}}-4]               ; p x
+    mov     ecx, dword [{{.SP}}-4]
+    cmp     ecx, 3
+    jbe     short su_op_formant_vowelok
+    mov     ecx, 3
+su_op_formant_vowelok:                      ; ecx = i, the index of the vowel
+    mov     dword [{{.SP}}-4], ecx
+    fisub   dword [{{.SP}}-4]               ; f x, f is the fraction between vowels i and i+1
+    lea     ecx, [ecx+ecx*2]
+{{- .Prepare "su_formant_table" | indent 4}}
+    lea     {{.CX}}, [{{.Use "su_formant_table"}}+{{.CX}}*2] ; CX points to the coefficients of vowel i
+    xor     eax, eax
+su_op_formant_coefloop:
+    fild    word [{{.CX}}+{{.AX}}*2+6]      ; b f x, where b is the coefficient of vowel i+1
+    fild    word [{{.CX}}+{{.AX}}*2]        ; a b f x, where a is the coefficient of vowel i
+    fsub    st1, st0                        ; a b-a f x
+    fxch                                    ; b-a a f x
+    fmul    st0, st2                        ; (b-a)*f a f x
+    faddp   st1, st0                        ; a+(b-a)*f f x
+{{- .Float 0.000030517578125 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.000030517578125 | .Use}}] ; c f x, where c is the interpolated coefficient / 32768
+    fstp    dword [{{.SP}}-12+{{.AX}}*4]    ; f x, dword [{{.SP}}-12+4*i] = the coefficient i
+    inc     eax
+    cmp     al, 3
+    jb      short su_op_formant_coefloop
+    fstp    st0                             ; x
+    fldz                                    ; o x, o is the output
+    xor     eax, eax
+su_op_formant_filterloop:
+    fld     dword [{{.WRK}}+{{.AX}}*8+4]    ; b o x
+    fmul    dword [{{.SP}}-12+{{.AX}}*4]    ; c*b o x
+    fadd    dword [{{.WRK}}+{{.AX}}*8]      ; l'=l+c*b o x
+    fst     dword [{{.WRK}}+{{.AX}}*8]      ; l' o x
+    fsubr   st0, st2                        ; x-l' o x
+    fld     dword [{{.WRK}}+{{.AX}}*8+4]    ; b x-l' o x
+    fmul    dword [{{.Input "formant" "resonance"}}] ; r*b x-l' o x
+    fsubp   st1, st0                        ; h=x-l'-r*b o x
+    fmul    dword [{{.SP}}-12+{{.AX}}*4]    ; c*h o x
+    fadd    dword [{{.WRK}}+{{.AX}}*8+4]    ; b'=b+c*h o x
+    fst     dword [{{.WRK}}+{{.AX}}*8+4]    ; b' o x
+    test    eax, eax
+    jz      short su_op_formant_firstformant
+    fmul    dword [{{.SP}}-4]               ; g*b' o x
+su_op_formant_firstformant:
+    faddp   st1, st0                        ; o' x
+    inc     eax
+    cmp     al, 2
+    jb      short su_op_formant_filterloop
+    fstp    st1                             ; o
+    fmul    dword [{{.Input "formant" "resonance"}}] ; r*o, scaling by the resonance keeps the gain at the formants constant
+    ret
+{{end}}
+
+
+{{- if .HasOp "ladder"}}
+;-------------------------------------------------------------------------------
+;   LADDER opcode: four pole lowpass ladder filter with drive
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  filtered(x)
+;   Stereo: l r ->  filtered(l) filtered(r)
+;   The filter is solved with zero delay feedback, so the resonance does not
+;   depend on the frequency. The input of the first stage is soft clipped.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_ladder" "Opcode"}}
+{{- if .Stereo "ladder"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fld     dword [{{.Input "ladder" "drive"}}] ; d x
+{{- .Float 15.0 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 15.0 | .Use}}]  ; 15*d x
+    fld1
+    faddp   st1, st0                        ; D x, where D=1+15*d
+    fmulp   st1, st0                        ; D*x
+    fld     dword [{{.Input "ladder" "frequency"}}] ; f D*x
+    fmul    st0, st0                        ; f^2 D*x
+{{- .Float 1.5393804 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 1.5393804 | .Use}}] ; 0.49*pi*f^2 D*x
+    fptan                                   ; 1 g D*x
+    fadd    st0, st1                        ; 1+g g D*x
+    fdivp   st1, st0                        ; G D*x, where G=g/(1+g)
+    fld     dword [{{.WRK}}]                ; s0 G D*x
+    fmul    st0, st1                        ; s0*G G D*x
+    fadd    dword [{{.WRK}}+4]              ; s0*G+s1 G D*x
+    fmul    st0, st1
+    fadd    dword [{{.WRK}}+8]
+    fmul    st0, st1
+    fadd    dword [{{.WRK}}+12]             ; ((s0*G+s1)*G+s2)*G+s3 G D*x
+    fld1
+    fsub    st0, st2                        ; 1-G ... G D*x
+    fmulp   st1, st0                        ; S G D*x, the output of the last stage when the input is 0
+    fmul    dword [{{.Input "ladder" "resonance"}}]
+{{- .Float 5.0 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 5.0 | .Use}}]   ; k*S G D*x, where k=5*r
+    fsubp   st2, st0                        ; G D*x-k*S
+    fld     st0                             ; G G D*x-k*S
+    fmul    st0, st0
+    fmul    st0, st0                        ; G^4 G D*x-k*S
+    fmul    dword [{{.Input "ladder" "resonance"}}]
+    fmul    dword [{{.Float 5.0 | .Use}}]   ; k*G^4 G D*x-k*S
+    fld1
+    faddp   st1, st0                        ; 1+k*G^4 G D*x-k*S
+    fdivp   st2, st0                        ; G u, where u=(D*x-k*S)/(1+k*G^4)
+    fxch                                    ; u G
+{{- .Float 0.6666667 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.6666667 | .Use}}] ; u*2/3 G
+    {{.Call "su_clip"}}                     ; c G
+    fld     st0                             ; c c G
+    fmul    st0, st0                        ; c^2 c G
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.5 | .Use}}]   ; c^2/2 c G
+{{- .Float 1.5 | .Prepare | indent 4}}
+    fsubr   dword [{{.Float 1.5 | .Use}}]   ; 1.5-c^2/2 c G
+    fmulp   st1, st0                        ; u' G, the soft clipped input
+    fxch                                    ; G u'
+    xor     ecx, ecx
+su_op_ladder_loop:                          ; G y, where y is the output of the previous stage
+    fld     st1                             ; y G y
+    fsub    dword [{{.WRK}}+{{.CX}}*4]      ; y-s G y
+    fmul    st0, st1                        ; v G y, where v=(y-s)*G
+    fld     st0                             ; v v G y
+    fadd    dword [{{.WRK}}+{{.CX}}*4]      ; y' v G y, where y'=v+s
+    fadd    st1, st0                        ; y' y'+v G y
+    fxch                                    ; y'+v y' G y
+    fstp    dword [{{.WRK}}+{{.CX}}*4]      ; y' G y, s <- y'+v
+    fstp    st2                             ; G y'
+    inc     ecx
+    cmp     cl, 4
+    jb      short su_op_ladder_loop
+    fstp    st0                             ; y
+    ret
+{{end}}
+
+
+{{- if .HasOp "phaser"}}
+;-------------------------------------------------------------------------------
+;   PHASER opcode: chain of first order all-pass filters with feedback
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  dry*x+allpass(x)
+;   Stereo: l r ->  dry*l+allpass(l) dry*r+allpass(r)
+;   Each stage outputs y=s+a*(u-s), where u is its input and s its state. The
+;   feedback is solved with zero delay feedback.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_phaser" "Opcode"}}
+    lodsb                                   ; load the number of stages to al
+{{- if .Stereo "phaser"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fld     st0                             ; x x
+    fmul    dword [{{.Input "phaser" "dry"}}] ; dry*x x
+    fstp    dword [{{.SP}}-4]               ; x, dword [{{.SP}}-4] = dry*x, nothing is pushed or called before it is used
+    fld     dword [{{.Input "phaser" "frequency"}}] ; f x
+    fmul    st0, st0                        ; f^2 x
+{{- .Float 1.5393804 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 1.5393804 | .Use}}] ; 0.49*pi*f^2 x
+    fptan                                   ; 1 g x
+    fld     st1                             ; g 1 g x
+    fsub    st0, st1                        ; g-1 1 g x
+    fxch    st2                             ; g 1 g-1 x
+    faddp   st1, st0                        ; g+1 g-1 x
+    fdivp   st1, st0                        ; a x, where a=(g-1)/(g+1)
+    fld1                                    ; ga a x
+    fldz                                    ; gb ga a x
+    xor     ecx, ecx
+su_op_phaser_gainloop:                      ; the output of the chain is ga*u+(1-a)*gb
+    fmul    st0, st2                        ; gb*a ga a x
+    fadd    dword [{{.WRK}}+{{.CX}}*4]      ; gb*a+s ga a x
+    fxch                                    ; ga gb' a x
+    fmul    st0, st2                        ; ga*a gb' a x
+    fxch                                    ; gb' ga' a x
+    inc     ecx
+    cmp     cl, al
+    jb      short su_op_phaser_gainloop
+    fld1                                    ; 1 gb ga a x
+    fsub    st0, st3                        ; 1-a gb ga a x
+    fmulp   st1, st0                        ; gb' ga a x, where gb'=(1-a)*gb
+    fld     dword [{{.Input "phaser" "feedback"}}]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]
+    fadd    st0, st0
+{{- .Float 0.99 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.99 | .Use}}]  ; k gb' ga a x, where k=.99*(2*fb-1)
+    fmul    st2, st0                        ; k gb' k*ga a x
+    fmulp   st1, st0                        ; k*gb' k*ga a x
+    faddp   st3, st0                        ; k*ga a x+k*gb'
+    fld1
+    fsubrp  st1, st0                        ; 1-k*ga a x+k*gb'
+    fdivp   st2, st0                        ; a u, where u=(x+k*gb')/(1-k*ga)
+    xor     ecx, ecx
+su_op_phaser_stageloop:                     ; a u, where u is the output of the previous stage
+    fld     st1                             ; u a u
+    fsub    dword [{{.WRK}}+{{.CX}}*4]      ; d a u, where d=u-s
+    fld     st0                             ; d d a u
+    fmul    st0, st2                        ; a*d d a u
+    fadd    dword [{{.WRK}}+{{.CX}}*4]      ; y d a u, where y=s+a*d
+    fadd    st1, st0                        ; y y+d a u
+    fxch                                    ; y+d y a u
+    fstp    dword [{{.WRK}}+{{.CX}}*4]      ; y a u, s <- y+d
+    fstp    st2                             ; a y
+    inc     ecx
+    cmp     cl, al
+    jb      short su_op_phaser_stageloop
+    fstp    st0                             ; y
+    fadd    dword [{{.SP}}-4]               ; dry*x+y
+    ret
+{{end}}
+
 
 {{- if .HasOp "belleq"}}
 ;-------------------------------------------------------------------------------
@@ -275,6 +505,73 @@ su_op_filter_skipneghighpass:
 {{end}}
 
 
+{{- if .HasOp "math"}}
+;-------------------------------------------------------------------------------
+;   MATH opcode: apply a function on the signal
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  f(x)
+;   Stereo: l r ->  f(l) f(r)
+;   where f is abs, sign, tanh, square or sqrt(abs(x)). Only the functions used
+;   by the song are included.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_math" "Opcode"}}
+    lodsb                                   ; load the function bit
+{{- if .Stereo "math"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathAbs}}
+    test    al, byte 0x01
+    jz      short su_op_math_not_abs
+    fabs                                    ; |x|
+    ret
+su_op_math_not_abs:
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSign}}
+    test    al, byte 0x02
+    jz      short su_op_math_not_sign
+    fldz                                    ; 0 x
+    fucomip st1                             ; x
+    je      short su_op_math_sign_zero      ; sign(0) = 0, so x is fine as it is
+    fstp    st0                             ;
+    fld1                                    ; 1
+    jb      short su_op_math_sign_zero      ; if (0 < x) we're done
+    fchs                                    ; -1
+su_op_math_sign_zero:
+    ret
+su_op_math_not_sign:
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathTanh}}
+    test    al, byte 0x04
+    jz      short su_op_math_not_tanh
+    fadd    st0, st0                        ; 2x
+    fldl2e                                  ; log2(e) 2x
+    fmulp   st1, st0                        ; 2x*log2(e)
+    {{.Call "su_power"}}                    ; e^(2x)
+    fld1                                    ; 1 e^(2x)
+    faddp   st1, st0                        ; e^(2x)+1
+    fld1                                    ; 1 e^(2x)+1
+    fadd    st0, st0                        ; 2 e^(2x)+1
+    fdivrp  st1, st0                        ; 2/(e^(2x)+1)
+    fld1                                    ; 1 2/(e^(2x)+1)
+    fsubrp  st1, st0                        ; 1-2/(e^(2x)+1) = tanh(x)
+    ret
+su_op_math_not_tanh:
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSquare}}
+    test    al, byte 0x08
+    jz      short su_op_math_not_square
+    fmul    st0, st0                        ; x^2
+    ret
+su_op_math_not_square:
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSqrt}}
+    fabs                                    ; |x|
+    fsqrt                                   ; sqrt(|x|)
+{{- end}}
+    ret
+{{end}}
+
+
 {{- if .HasOp "pan" -}}
 ;-------------------------------------------------------------------------------
 ;   PAN opcode: pan the signal
@@ -307,6 +604,43 @@ su_op_pan_do:
 {{end}}
 
 
+{{- if .HasOp "midside"}}
+;-------------------------------------------------------------------------------
+;   MIDSIDE opcode: mid/side encoding, decoding and stereo width
+;-------------------------------------------------------------------------------
+;   Encode: l r ->  m w*s, where m=(l+r)/2, s=(l-r)/2 and w is the width
+;   Decode: m s ->  m+w*s m-w*s
+;   Width:  encode and decode in one go
+;-------------------------------------------------------------------------------
+{{.Func "su_op_midside" "Opcode"}}
+    lodsb                                       ; bit 0: encode, bit 1: decode
+{{- .Prepare (.Float 0.5)}}
+    test    al, byte 0x01
+    jz      short su_op_midside_noencode
+    fld     st0                                 ; l l r
+    fadd    st0, st2                            ; l+r l r
+    fxch    st2                                 ; r l l+r
+    fsubp   st1, st0                            ; l-r l+r
+    fmul    dword [{{.Use (.Float 0.5)}}]      ; s l+r
+    fxch                                        ; l+r s
+    fmul    dword [{{.Use (.Float 0.5)}}]      ; m s
+su_op_midside_noencode:
+    fxch                                        ; s m
+    fmul    dword [{{.Input "midside" "width"}}]
+    fadd    st0, st0                            ; w*s m, where w=2*width
+    fxch                                        ; m w*s
+    test    al, byte 0x02
+    jz      short su_op_midside_nodecode
+    fld     st0                                 ; m m s
+    fadd    st0, st2                            ; m+s m s
+    fxch    st2                                 ; s m m+s
+    fsubp   st1, st0                            ; m-s m+s
+    fxch                                        ; m+s m-s
+su_op_midside_nodecode:
+    ret
+{{end}}
+
+
 {{- if .HasOp "delay"}}
 ;-------------------------------------------------------------------------------
 ;   DELAY opcode: adds delay effect to the signal
@@ -319,6 +653,10 @@ su_op_pan_do:
 ;-------------------------------------------------------------------------------
 {{.Func "su_op_delay" "Opcode"}}
     lodsw                           ; al = delay index, ah = delay count
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    movzx   edi, byte [{{.VAL}}]        ; edi = 0 if no ping-pong, otherwise spread+1
+    inc     {{.VAL}}                    ; inc does not touch the carry flag, which still tells if the delay is stereo
+{{- end}}
     {{- .PushRegs .VAL "DelayVal" .COM "DelayCom" | indent 4}}
     movzx   ebx, al
 {{- if .Library}}
@@ -334,6 +672,56 @@ su_op_pan_do:
     jnc     su_op_delay_mono
 {{- end}}
 {{- if .Stereo "delay"}}
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    test    edi, edi
+    jz      su_op_delay_stereo
+    fxch                            ; r l
+    push    {{.DI}}
+    fild    dword [{{.SP}}]         ; s+1 r l, where s is the spread
+    pop     {{.DI}}
+    fld1
+    fsubp   st1, st0                ; s r l
+{{- .Float 0.0078125 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.0078125 | .Use}}] ; s/128 r l
+    fld     st1                     ; r s/128 r l
+    fadd    st0, st3                ; r+l s/128 r l
+{{- .Float 0.25 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.25 | .Use}}] ; h s/128 r l, where h is half of the mono sum, so the feeds add up to the mono sum
+    fmul    st1, st0                ; h h*s/128 r l
+    fld     st1                     ; h*s/128 h h*s/128 r l
+    fadd    st0, st1                ; h*s/128+h h h*s/128 r l
+    {{.Push .AX "DelayLeftFeed"}}
+    fstp    dword [{{.SP}}]         ; h h*s/128 r l, the left feed is kept in the stack
+    fsubrp  st1, st0                ; h-h*s/128 r l
+    push    {{.AX}}                 ; save _ah (delay count)
+    call    su_op_delay_do_feed     ; D(r) l        feed the right channel lines with h-h*s/128
+    pop     {{.AX}}
+    fxch                            ; l D(r)
+    fld     dword [{{.SP}}]         ; h+h*s/128 l D(r)
+    {{.Pop .DI}}
+    push    {{.AX}}
+    call    su_op_delay_do_feed     ; D(l) D(r)     feed the left channel lines with h+h*s/128
+    pop     {{.AX}}
+    ; cross the feedback by swapping the samples just written to the right and left delay lines
+    movzx   eax, ah
+    inc     eax
+    shr     eax, 1                  ; eax = number of delay lines per channel
+    imul    eax, eax, su_delayline_wrk.size
+    mov     {{.DI}}, {{.CX}}
+    sub     {{.DI}}, {{.AX}}                ; DI = first delay line of the left channel
+su_op_delay_pingpong_loop:
+    mov     {{.BX}}, {{.DI}}
+    sub     {{.BX}}, {{.AX}}                ; BX = the same delay line of the right channel
+    fld     dword [{{.DI}}+su_delayline_wrk.buffer+{{.SI}}*4]
+    fld     dword [{{.BX}}+su_delayline_wrk.buffer+{{.SI}}*4]
+    fstp    dword [{{.DI}}+su_delayline_wrk.buffer+{{.SI}}*4]
+    fstp    dword [{{.BX}}+su_delayline_wrk.buffer+{{.SI}}*4]
+    add     {{.DI}}, su_delayline_wrk.size
+    cmp     {{.DI}}, {{.CX}}
+    jb      su_op_delay_pingpong_loop
+    jmp     su_op_delay_done
+su_op_delay_stereo:
+{{- end}}
     push    {{.AX}}                 ; save _ah (delay count)
     fxch                        ; r l
     call    su_op_delay_do      ; D(r) l        process delay for the right channel
@@ -342,6 +730,9 @@ su_op_pan_do:
 su_op_delay_mono:               ; flow into mono delay
 {{- end}}
     call    su_op_delay_do      ; when stereo delay is not enabled, we could inline this to save 5 bytes, but I expect stereo delay to be farely popular so maybe not worth the hassle
+{{- if and (.Stereo "delay") (.SupportsParamValue "delay" "pingpong" 1)}}
+su_op_delay_done:
+{{- end}}
     mov     {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}],{{.CX}}   ; move delay workspace pointer back to stack.
     {{- .PopRegs .VAL .COM | indent 4}}
 {{- if .SupportsModulation "delay" "delaytime"}}
@@ -364,6 +755,9 @@ su_op_delay_mono:               ; flow into mono delay
 ;-------------------------------------------------------------------------------
 {{.Func "su_op_delay_do"}}                         ; x y
     fld     st0
+{{- if and (.Stereo "delay") (.SupportsParamValue "delay" "pingpong" 1)}}
+su_op_delay_do_feed:                            ; x y, where x is fed to the delay lines and y is the dry signal
+{{- end}}
     fmul    dword [{{.Input "delay" "pregain"}}]  ; p*x y
     fmul    dword [{{.Input "delay" "pregain"}}]  ; p*p*x y
     fxch                                        ; y p*p*x
@@ -430,6 +824,510 @@ su_op_delay_loop:
 {{end}}
 
 
+{{- if .HasOp "pluck"}}
+;-------------------------------------------------------------------------------
+;   PLUCK opcode: Karplus-Strong comb filter, tuned to the note
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  x+g*damp(b[t-L]), where L is the period of the note
+;   Stereo: l r ->  the same for both channels, with opposite detunes
+;-------------------------------------------------------------------------------
+{{.Func "su_op_pluck" "Opcode"}}
+    {{- .PushRegs .VAL "PluckVal" | indent 4}}
+    movzx   esi, word [{{.Stack "GlobalTick"}}] ; notice that we load word, so we wrap at 65536
+    mov     {{.CX}}, {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}] ; pluck uses the delay lines, like the delay
+    fld     dword [{{.Input "pluck" "detune"}}] ; e x, where e is the detune [0,1]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]   ; e-.5 x
+    fadd    st0, st0                        ; d=2*(e-.5) x, where d is the detune [-1,1]
+    {{.Push .AX "PluckDetune"}}
+    fstp    dword [{{.SP}}]                 ; x, the detune is kept in the stack
+{{- if .StereoAndMono "pluck"}}
+    jnc     su_op_pluck_mono
+{{- end}}
+{{- if .Stereo "pluck"}}
+    fxch                                    ; r l
+    {{.Call "su_op_pluck_do"}}              ; P(r) l, process the right channel first
+    fxch                                    ; l P(r)
+    fld     dword [{{.SP}}]
+    fchs                                    ; -d l P(r), negate the detune for second round
+    fstp    dword [{{.SP}}]
+su_op_pluck_mono:
+{{- end}}
+    {{.Call "su_op_pluck_do"}}
+    {{.Pop .AX}}
+    mov     {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}], {{.CX}} ; move delay workspace pointer back to stack.
+    {{- .PopRegs .VAL | indent 4}}
+    ret
+
+;-------------------------------------------------------------------------------
+;   su_op_pluck_do: processes one channel of the pluck
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   x, the excitation
+;               esi     :   the global tick
+;               CX      :   pointer to the delay line
+;   Output:     st0     :   y = x+g*o, which is also written to the delay line
+;               CX      :   pointer to the next delay line
+;-------------------------------------------------------------------------------
+{{.Func "su_op_pluck_do"}}
+    fld     dword [{{.Input "pluck" "transpose"}}]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]
+{{- .Float 0.0078125 | .Prepare | indent 4}}
+    fdiv    dword [{{.Float 0.0078125 | .Use}}] ; t x
+    fadd    dword [{{.Stack "PluckDetune"}}] ; t+d x
+    fiadd   dword [{{.INP}}-su_voice.inputs+su_voice.note] ; t+d+n x
+{{- .Int 0x3DAAAAAA | .Prepare | indent 4}}
+    fmul    dword [{{.Int 0x3DAAAAAA | .Use}}]
+    {{.Call "su_power"}}
+{{- .Float 0.000092696138 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.000092696138 | .Use}}] ; w x, the frequency in cycles per sample
+    fld1
+    fdivrp  st1, st0                        ; L x, the period in samples
+    fld     dword [{{.Input "pluck" "damp"}}]
+{{- .Float 0.99609375 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.99609375 | .Use}}] ; a L x, where a is the damping
+    fld1
+    fsub    st0, st1                        ; 1-a a L x
+    fdivp   st1, st0                        ; a/(1-a) L x, the delay of the damping filter at low frequencies
+    fsubp   st1, st0                        ; L' x, L'=L-a/(1-a) keeps the pluck in tune
+    fld1                                    ; 1 L' x
+    fucomi  st1                             ; if 1 < L'
+    fcmovb  st0, st1                        ;   then L' -> 1
+    fstp    st1                             ; L''=max(L',1) x
+    fld     st0                             ; L'' L'' x
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}] ; L''-.5 L'' x
+    fistp   dword [{{.SP}}-4]               ; L'' x, dword [{{.SP}}-4] = n, the integer part of the period
+    fisub   dword [{{.SP}}-4]               ; f x, the fractional part
+    mov     edi, esi
+    sub     di, word [{{.SP}}-4]            ; we perform the math in 16-bit to wrap around
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s0 f x, where s0 = b[t-n]
+    dec     di
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s1 s0 f x, where s1 = b[t-n-1]
+    fsub    st0, st1                        ; s1-s0 s0 f x
+    fmulp   st2, st0                        ; s0 (s1-s0)*f x
+    faddp   st1, st0                        ; s x, the delayed signal
+    fld     dword [{{.CX}}+su_delayline_wrk.filtstate] ; o s x
+    fsub    st0, st1                        ; o-s s x
+    fmul    dword [{{.Input "pluck" "damp"}}]
+{{- .Float 0.99609375 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.99609375 | .Use}}] ; a*(o-s) s x
+    faddp   st1, st0                        ; o' x, o'=s+a*(o-s)
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fadd    dword [{{.Float 0.5 | .Use}}] ; add and sub small offset to prevent denormalization
+    fsub    dword [{{.Float 0.5 | .Use}}]
+    fst     dword [{{.CX}}+su_delayline_wrk.filtstate] ; o' x
+    fld1
+    fsub    dword [{{.Input "pluck" "decay"}}] ; 1-c o' x, where c is the decay
+    fmul    st0, st0
+    fmul    st0, st0                        ; (1-c)^4 o' x
+    fld1
+    fsubrp  st1, st0                        ; g o' x, where g=1-(1-c)^4 is the feedback
+    fmulp   st1, st0                        ; g*o' x
+    faddp   st1, st0                        ; y=x+g*o'
+    fst     dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; b[t]=y
+    add     {{.CX}}, su_delayline_wrk.size  ; go to next delay line
+    ret
+{{end}}
+
+
+{{- if .HasOp "chorus"}}
+;-------------------------------------------------------------------------------
+;   CHORUS opcode: delay line read at a position modulated by a sine LFO
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  x+w*b[t-L], where L=1+1024*d+512*e*(1+sin(2*pi*p))
+;   Stereo: l r ->  the same for both channels, the LFO of r ahead by the spread
+;-------------------------------------------------------------------------------
+{{.Func "su_op_chorus" "Opcode"}}
+    {{- .PushRegs .VAL "ChorusVal" | indent 4}}
+    movzx   esi, word [{{.Stack "GlobalTick"}}] ; notice that we load word, so we wrap at 65536
+    mov     {{.CX}}, {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}] ; chorus uses the delay lines, like the delay
+    fld     dword [{{.Input "chorus" "rate"}}] ; r x
+    fmul    st0, st0                        ; r^2 x
+{{- .Float 0.00022675737 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.00022675737 | .Use}}] ; dp x, the max rate is 10 Hz
+    fadd    dword [{{.WRK}}]                ; p+dp x
+    fld     st0                             ; p+dp p+dp x
+    frndint                                 ; round(p+dp) p+dp x
+    fsubp   st1, st0                        ; p' x, p'=p+dp-round(p+dp) wraps the phase
+    fst     dword [{{.WRK}}]                ; p' x
+{{- if .StereoAndMono "chorus"}}
+    jnc     su_op_chorus_mono
+{{- end}}
+{{- if .Stereo "chorus"}}
+    fxch    st2                             ; r l p'
+    fld     st2                             ; p' r l p'
+    fld     dword [{{.Input "chorus" "spread"}}]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.5 | .Use}}]   ; s/2 p' r l p'
+    faddp   st1, st0                        ; p'+s/2 r l p'
+    call    su_op_chorus_do                 ; C(r) l p', process the right channel first
+    fxch    st2                             ; p' l C(r)
+su_op_chorus_mono:
+{{- end}}
+    call    su_op_chorus_do
+    mov     {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}], {{.CX}} ; move delay workspace pointer back to stack.
+    {{- .PopRegs .VAL | indent 4}}
+    ret
+
+;-------------------------------------------------------------------------------
+;   su_op_chorus_do: processes one channel of the chorus
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   p, the phase of the LFO
+;               st1     :   x, the signal
+;               esi     :   the global tick
+;               CX      :   pointer to the delay line
+;   Output:     st0     :   y = x+w*s, where s is the delayed signal
+;               CX      :   pointer to the next delay line
+;-------------------------------------------------------------------------------
+{{.Func "su_op_chorus_do"}}
+    fldpi                                   ; pi p x
+    fadd    st0, st0                        ; 2*pi p x
+    fmulp   st1, st0                        ; 2*pi*p x
+    fsin                                    ; sin(2*pi*p) x
+    fld1
+    faddp   st1, st0                        ; 1+sin(2*pi*p) x
+    fmul    dword [{{.Input "chorus" "depth"}}]
+{{- .Float 512.0 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 512.0 | .Use}}] ; 512*e*(1+sin(2*pi*p)) x
+    fld     dword [{{.Input "chorus" "delay"}}]
+{{- .Float 1024.0 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 1024.0 | .Use}}]
+    faddp   st1, st0
+    fld1
+    faddp   st1, st0                        ; L x
+    fld     st0                             ; L L x
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}] ; L-.5 L x
+    fistp   dword [{{.SP}}-4]               ; L x, dword [{{.SP}}-4] = n, the integer part of the delay
+    fisub   dword [{{.SP}}-4]               ; f x, the fractional part
+    mov     edi, esi
+    sub     di, word [{{.SP}}-4]            ; we perform the math in 16-bit to wrap around
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s0 f x, where s0 = b[t-n]
+    dec     di
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s1 s0 f x, where s1 = b[t-n-1]
+    fsub    st0, st1                        ; s1-s0 s0 f x
+    fmulp   st2, st0                        ; s0 (s1-s0)*f x
+    faddp   st1, st0                        ; s x, the delayed signal
+    fld     dword [{{.Input "chorus" "feedback"}}]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]
+    fadd    st0, st0                        ; 2*(b-.5) s x, where b is the feedback
+{{- .Float 0.99 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.99 | .Use}}]  ; g s x, g=.99*(2*b-1)
+    fmul    st0, st1                        ; g*s s x
+    fadd    st0, st2                        ; x+g*s s x
+    fstp    dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; s x, b[t]=x+g*s
+    fmul    dword [{{.Input "chorus" "wet"}}]
+    faddp   st1, st0                        ; y=x+w*s
+    add     {{.CX}}, su_delayline_wrk.size  ; go to next delay line
+    ret
+{{end}}
+
+
+{{- if .HasOp "reverb"}}
+;-------------------------------------------------------------------------------
+;   REVERB opcode: feedback delay network reverb
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  dr*x+w*(o0-o3)
+;   Stereo: l r ->  dr*l+w*(o0-o3) dr*r+w*(o1-o2)
+;
+;   where o0-o3 are the damped outputs of the four lines of the network. The
+;   lines are mixed with a Hadamard matrix and fed back, adding the predelayed
+;   mono sum of the input. The line lengths are modulated by a sine LFO.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_reverb" "Opcode"}}
+    lodsb                                   ; al = delay index
+    {{- .PushRegs .VAL "ReverbVal" .COM "ReverbCom" | indent 4}}
+{{- if .StereoAndMono "reverb"}}
+    setc    ah                              ; ah = stereo, as the loop trashes the flags
+{{- end}}
+    movzx   ebx, al
+{{- if .Library}}
+    mov     {{.SI}}, [{{.Stack "DelayTable"}}] ; when using runtime tables, delaytimes is pulled from the stack so can be a pointer to heap
+    lea     {{.BX}}, [{{.SI}} + {{.BX}}*2]
+{{- else}}
+{{- .Prepare "su_delay_times" | indent 4}}
+    lea     {{.BX}},[{{.Use "su_delay_times"}} + {{.BX}}*2] ; BX now points to the line lengths in the delay time table
+{{- end}}
+    movzx   esi, word [{{.Stack "GlobalTick"}}] ; notice that we load word, so we wrap at 65536
+    mov     {{.CX}}, {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}] ; reverb uses the delay lines, like the delay
+    fld     st0                             ; x x
+{{- if .StereoAndMono "reverb"}}
+    test    ah, ah
+    jz      su_op_reverb_mono
+{{- end}}
+{{- if .Stereo "reverb"}}
+    fadd    st0, st2                        ; l+r l r
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.5 | .Use}}]   ; i l r, where i=(l+r)/2 is the mono sum
+su_op_reverb_mono:
+{{- end}}
+    fstp    dword [{{.CX}}+4*su_delayline_wrk.size+su_delayline_wrk.buffer+{{.SI}}*4] ; x, the fifth line is the predelay
+    mov     edi, esi
+    sub     di, word [{{.BX}}+8]            ; we perform the math in 16-bit to wrap around
+    fld     dword [{{.CX}}+4*su_delayline_wrk.size+su_delayline_wrk.buffer+{{.DI}}*4]
+    fstp    dword [{{.SP}}-8]               ; x, dword [{{.SP}}-8] = i, nothing is pushed or called while the temporaries are below the stack pointer
+    fld     dword [{{.WRK}}]                ; p x
+{{- .Float 0.000011337868 | .Prepare | indent 4}}
+    fadd    dword [{{.Float 0.000011337868 | .Use}}] ; p+dp x, the LFO runs at 0.5 Hz
+    fld     st0                             ; p+dp p+dp x
+    frndint                                 ; round(p+dp) p+dp x
+    fsubp   st1, st0                        ; p' x, p'=p+dp-round(p+dp) wraps the phase
+    fst     dword [{{.WRK}}]                ; p' x
+    fstp    dword [{{.SP}}-12]              ; x
+    mov     al, 4
+su_op_reverb_loop:
+        fild    word [{{.BX}}]                          ; L x, where L is the line length
+        fld     dword [{{.SP}}-12]                      ; p L x
+        fldpi                                           ; pi p L x
+        fadd    st0, st0                                ; 2*pi p L x
+        fmulp   st1, st0                                ; 2*pi*p L x
+        fsin                                            ; sin(2*pi*p) L x
+        fmul    dword [{{.Input "reverb" "modulation"}}]
+{{- .Float 16.0 | .Prepare | indent 8}}
+        fmul    dword [{{.Float 16.0 | .Use}}]          ; 16*m*sin(2*pi*p) L x
+        faddp   st1, st0                                ; L' x, the modulated length
+        fld     st0                                     ; L' L' x
+{{- .Float 0.5 | .Prepare | indent 8}}
+        fsub    dword [{{.Float 0.5 | .Use}}] ; L'-.5 L' x
+        fistp   dword [{{.SP}}-4]                       ; L' x, dword [{{.SP}}-4] = n, the integer part of the length
+        fisub   dword [{{.SP}}-4]                       ; f x, the fractional part
+        mov     edi, esi
+        sub     di, word [{{.SP}}-4]                    ; we perform the math in 16-bit to wrap around
+        fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s0 f x, where s0 = b[t-n]
+        dec     di
+        fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s1 s0 f x, where s1 = b[t-n-1]
+        fsub    st0, st1                                ; s1-s0 s0 f x
+        fmulp   st2, st0                                ; s0 (s1-s0)*f x
+        faddp   st1, st0                                ; s x, the delayed signal
+        fld1                                            ; 1 s x
+        fsub    dword [{{.Input "reverb" "damping"}}]   ; 1-da s x
+        fmulp   st1, st0                                ; s*(1-da) x
+        fld     dword [{{.Input "reverb" "damping"}}]   ; da s*(1-da) x
+        fmul    dword [{{.CX}}+su_delayline_wrk.filtstate] ; o*da s*(1-da) x
+        faddp   st1, st0                                ; o*da+s*(1-da) x
+{{- .Float 0.5 | .Prepare | indent 8}}
+        fadd    dword [{{.Float 0.5 | .Use}}] ; add and sub small offset to prevent denormalization
+        fsub    dword [{{.Float 0.5 | .Use}}]
+        fstp    dword [{{.CX}}+su_delayline_wrk.filtstate] ; x, o'=o*da+s*(1-da)
+        fld     dword [{{.SP}}-12]
+{{- .Float 0.25 | .Prepare | indent 8}}
+        fadd    dword [{{.Float 0.25 | .Use}}]
+        fstp    dword [{{.SP}}-12]                      ; x, the next line is a quarter cycle ahead in the LFO
+        add     {{.BX}}, 2                              ; move to next line length
+        add     {{.CX}}, su_delayline_wrk.size          ; go to next delay line
+        dec     al
+        jnz     su_op_reverb_loop
+    sub     {{.CX}}, 4*su_delayline_wrk.size            ; back to the first line
+    fld1                                                ; 1 x
+    fsub    dword [{{.Input "reverb" "decay"}}]         ; 1-d x
+    fmul    st0, st0                                    ; (1-d)^2 x
+    fld1                                                ; 1 (1-d)^2 x
+    fsubrp  st1, st0                                    ; g x, g=1-(1-d)^2 is the feedback
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.5 | .Use}}]     ; h x, h=g/2 so the Hadamard matrix is orthogonal
+    fstp    dword [{{.SP}}-12]                          ; x
+    fld     dword [{{.CX}}+su_delayline_wrk.filtstate]
+    fadd    dword [{{.CX}}+su_delayline_wrk.size+su_delayline_wrk.filtstate] ; a x, a=o0+o1
+    fld     dword [{{.CX}}+2*su_delayline_wrk.size+su_delayline_wrk.filtstate]
+    fadd    dword [{{.CX}}+3*su_delayline_wrk.size+su_delayline_wrk.filtstate] ; c a x, c=o2+o3
+    fld     st1                                         ; a c a x
+    fadd    st0, st1                                    ; a+c c a x
+    fmul    dword [{{.SP}}-12]
+    fadd    dword [{{.SP}}-8]
+    fstp    dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; c a x, b0[t]=h*(a+c)+i
+    fsubp   st1, st0                                    ; a-c x
+    fmul    dword [{{.SP}}-12]
+    fadd    dword [{{.SP}}-8]
+    fstp    dword [{{.CX}}+2*su_delayline_wrk.size+su_delayline_wrk.buffer+{{.SI}}*4] ; x, b2[t]=h*(a-c)+i
+    fld     dword [{{.CX}}+su_delayline_wrk.filtstate]
+    fsub    dword [{{.CX}}+su_delayline_wrk.size+su_delayline_wrk.filtstate] ; b x, b=o0-o1
+    fld     dword [{{.CX}}+2*su_delayline_wrk.size+su_delayline_wrk.filtstate]
+    fsub    dword [{{.CX}}+3*su_delayline_wrk.size+su_delayline_wrk.filtstate] ; e b x, e=o2-o3
+    fld     st1                                         ; b e b x
+    fadd    st0, st1                                    ; b+e e b x
+    fmul    dword [{{.SP}}-12]
+    fadd    dword [{{.SP}}-8]
+    fstp    dword [{{.CX}}+su_delayline_wrk.size+su_delayline_wrk.buffer+{{.SI}}*4] ; e b x, b1[t]=h*(b+e)+i
+    fsubp   st1, st0                                    ; b-e x
+    fmul    dword [{{.SP}}-12]
+    fadd    dword [{{.SP}}-8]
+    fstp    dword [{{.CX}}+3*su_delayline_wrk.size+su_delayline_wrk.buffer+{{.SI}}*4] ; x, b3[t]=h*(b-e)+i
+    fmul    dword [{{.Input "reverb" "dry"}}]           ; dr*x
+    fld     dword [{{.CX}}+su_delayline_wrk.filtstate]
+    fsub    dword [{{.CX}}+3*su_delayline_wrk.size+su_delayline_wrk.filtstate] ; o0-o3 dr*x
+    fmul    dword [{{.Input "reverb" "wet"}}]
+    faddp   st1, st0                                    ; dr*x+w*(o0-o3)
+{{- if .StereoAndMono "reverb"}}
+    test    ah, ah
+    jz      su_op_reverb_end
+{{- end}}
+{{- if .Stereo "reverb"}}
+    fxch                                                ; r l'
+    fmul    dword [{{.Input "reverb" "dry"}}]           ; dr*r l'
+    fld     dword [{{.CX}}+su_delayline_wrk.size+su_delayline_wrk.filtstate]
+    fsub    dword [{{.CX}}+2*su_delayline_wrk.size+su_delayline_wrk.filtstate] ; o1-o2 dr*r l'
+    fmul    dword [{{.Input "reverb" "wet"}}]
+    faddp   st1, st0                                    ; r' l'
+    fxch                                                ; l' r'
+su_op_reverb_end:
+{{- end}}
+    add     {{.CX}}, 5*su_delayline_wrk.size            ; skip the lines of this reverb
+    mov     {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}], {{.CX}} ; move delay workspace pointer back to stack.
+    {{- .PopRegs .VAL .COM | indent 4}}
+    ret
+{{end}}
+
+
+{{- if .HasOp "follower"}}
+;-------------------------------------------------------------------------------
+;   FOLLOWER opcode: envelope follower
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  l, where l is the smoothed absolute value of x
+;   Stereo: l r ->  the same for both channels
+;-------------------------------------------------------------------------------
+{{.Func "su_op_follower" "Opcode"}}
+{{- if .Stereo "follower"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fabs                                        ; |x|
+    fld     dword [{{.WRK}}]                    ; l |x|
+    fucomi  st0, st1
+    setnb   al                                  ; if (st0 >= st1) al = 1; else al = 0;
+    fsubp   st1, st0                            ; |x|-l
+    {{.Call "su_nonlinear_map"}}                ; c |x|-l, c is either attack or release parameter mapped in a nonlinear way
+    fmulp   st1, st0                            ; c*(|x|-l)
+    fadd    dword [{{.WRK}}]                    ; l'=l+c*(|x|-l)
+    fst     dword [{{.WRK}}]                    ; l'
+    ret
+{{end}}
+
+
+{{- if .HasOp "slew"}}
+;-------------------------------------------------------------------------------
+;   SLEW opcode: slew limiter
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  y+max(min(x-y,r),-f), where y is the previous output
+;   Stereo: l r ->  the same for both channels
+;-------------------------------------------------------------------------------
+{{.Func "su_op_slew" "Opcode"}}
+{{- if .Stereo "slew"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fsub    dword [{{.WRK}}]                    ; d=x-y
+    xor     eax, eax
+    {{.Call "su_nonlinear_map"}}                ; r d, r is the rise parameter mapped in a nonlinear way
+    fucomi  st0, st1
+    fcmovnb st0, st1                            ; if (r >= d) r = d
+    fstp    st1                                 ; min(d,r)
+    inc     eax
+    {{.Call "su_nonlinear_map"}}                ; f min(d,r), f is the fall parameter mapped in a nonlinear way
+    fchs                                        ; -f min(d,r)
+    fucomi  st0, st1
+    fcmovb  st0, st1                            ; if (-f < min(d,r)) -f = min(d,r)
+    fstp    st1                                 ; d'=max(min(d,r),-f)
+    fadd    dword [{{.WRK}}]                    ; y'=y+d'
+    fst     dword [{{.WRK}}]                    ; y'
+    ret
+{{end}}
+
+
+{{- if .HasOp "limiter"}}
+;-------------------------------------------------------------------------------
+;   LIMITER opcode: brickwall limiter with lookahead
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  g*x[t-L]
+;   Stereo: l r ->  g*l[t-L] g*r[t-L], where g is common for both channels
+;   The gain reduction needed by each sample is faded in linearly during the
+;   lookahead, so the output does not exceed the ceiling.
+;-------------------------------------------------------------------------------
+{{.Func "su_op_limiter" "Opcode"}}
+    lodsb                                   ; load the lookahead to al
+    {{- .PushRegs .VAL "LimiterVal" .COM "LimiterCom" | indent 4}}
+{{- if .StereoAndMono "limiter"}}
+    setc    bl                              ; save the stereo bit, as the carry flag will be trashed
+{{- end}}
+    movzx   esi, word [{{.Stack "GlobalTick"}}] ; notice that we load word, so we wrap at 65536
+    mov     {{.CX}}, {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}] ; limiter uses the delay lines, like the delay
+    movzx   eax, al
+    lea     eax, [{{.AX}}*2+1]              ; L=2*lookahead+1
+    fld     st0
+    fabs                                    ; p x, where p is the peak
+{{- if .StereoAndMono "limiter"}}
+    jnc     su_op_limiter_peakmono
+{{- end}}
+{{- if .Stereo "limiter"}}
+    fld     st2
+    fabs                                    ; |r| |l| l r
+    fucomi  st1                             ; if |r| < |l|
+    fcmovb  st0, st1                        ;   |r| = |l|
+    fstp    st1                             ; p l r
+su_op_limiter_peakmono:
+{{- end}}
+    fld     dword [{{.Input "limiter" "ceiling"}}] ; c p x
+    fucomi  st1                             ; if c < p
+    fcmovb  st0, st1                        ;   c = p
+    fstp    st1                             ; max(c,p) x
+    fdivr   dword [{{.Input "limiter" "ceiling"}}] ; c/max(c,p) x
+    fld1
+    fsubrp  st1, st0                        ; 1-c/max(c,p) x, the gain reduction needed by the incoming sample
+    fstp    dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; x
+    fldz                                    ; h x
+    mov     dword [{{.SP}}-4], eax
+    fild    dword [{{.SP}}-4]               ; k h x, where k=L
+    mov     edi, esi
+    sub     di, ax                          ; we perform the math in 16-bit to wrap around
+su_op_limiter_loop:                         ; the gain reduction needed k samples ago is faded in linearly
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s k h x, where s=b[t-k]
+    fmul    st0, st1                        ; s*k k h x
+    fucomi  st2                             ; if s*k < h
+    fcmovb  st0, st2                        ;   s*k = h
+    fstp    st2                             ; k h' x
+    fld1
+    fsubp   st1, st0                        ; k-1 h' x
+    inc     di
+    cmp     di, si
+    jne     short su_op_limiter_loop
+    fstp    st0                             ; h x
+    fidiv   dword [{{.SP}}-4]               ; h/L x
+    sub     di, ax                          ; di = t-L
+    mov     eax, {{.InputNumber "limiter" "release"}}
+    {{.Call "su_nonlinear_map"}}            ; a h/L x
+    fld1
+    fsubrp  st1, st0                        ; 1-a h/L x
+    fmul    dword [{{.WRK}}]                ; (1-a)*r h/L x, where r is the previous gain reduction
+    fucomi  st1                             ; if (1-a)*r < h/L
+    fcmovb  st0, st1                        ;   (1-a)*r = h/L
+    fstp    st1                             ; r' x
+    fst     dword [{{.WRK}}]                ; r' x
+    fld1
+    fsubrp  st1, st0                        ; g x, where g=1-r'
+    add     {{.CX}}, su_delayline_wrk.size  ; go to the delay line of the signal
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s g l r, where s=l[t-L]
+    fmul    st0, st1                        ; g*s g l r
+    fxch    st2                             ; l g g*s r
+    fstp    dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; g l' r
+    add     {{.CX}}, su_delayline_wrk.size
+{{- if .StereoAndMono "limiter"}}
+    shr     bl, 1                           ; restore the stereo bit to carry
+    jnc     su_op_limiter_mono
+{{- end}}
+{{- if .Stereo "limiter"}}
+    fld     dword [{{.CX}}+su_delayline_wrk.buffer+{{.DI}}*4] ; s g l' r, where s=r[t-L]
+    fmul    st0, st1                        ; g*s g l' r
+    fxch    st3                             ; r g l' g*s
+    fstp    dword [{{.CX}}+su_delayline_wrk.buffer+{{.SI}}*4] ; g l' r'
+    add     {{.CX}}, su_delayline_wrk.size
+su_op_limiter_mono:
+{{- end}}
+    fstp    st0                             ; l' r'
+    mov     {{.PTRWORD}} [{{.Stack "DelayWorkSpace"}}], {{.CX}} ; move delay workspace pointer back to stack.
+    {{- .PopRegs .VAL .COM | indent 4}}
+    ret
+{{end}}
+
+
 {{- if .HasOp "compressor"}}
 ;-------------------------------------------------------------------------------
 ;   COMPRES opcode: push compressor gain to stack
@@ -438,8 +1336,15 @@ su_op_delay_loop:
 ;           you can either MULP to compress the signal or SEND it to a GAIN
 ;           somewhere else for compressor side-chaining.
 ;   Stereo: push g g on stack, where g is calculated using l^2 + r^2
+;   Sidechain: the signal (k or kl kr) is a key driving the gain reduction and
+;           it is replaced by g (or g g), so MULP compresses the signal below
+;           the key.
 ;-------------------------------------------------------------------------------
 {{.Func "su_op_compressor" "Opcode"}}
+{{- if .SupportsParamValue "compressor" "sidechain" 1}}
+    lodsb                                       ; al = sidechain flag
+    mov     edi, eax                            ; keep it in edi, as al is needed below
+{{- end}}
     fld     st0                                 ; x x
     fmul    st0, st0                            ; x^2 x
 {{- if .StereoAndMono "compressor"}}
@@ -452,6 +1357,12 @@ su_op_delay_loop:
     faddp   st1, st0                            ; y^2+x^2 l r
 {{- if .StereoAndMono "compressor"}}
     call    su_op_compressor_mono               ; So, for stereo, we square both left & right and add them up
+{{- if .SupportsParamValue "compressor" "sidechain" 1}}
+    test    edi, edi
+    jz      su_op_compressor_stereo_nokey
+    fstp    st1                                 ; g, the right channel of the key was not yet dropped
+su_op_compressor_stereo_nokey:
+{{- end}}
     fld     st0                                 ; and return the computed gain two times, ready for MULP STEREO
     ret
 su_op_compressor_mono:
@@ -486,6 +1397,15 @@ su_op_compressor_mono:
                                                 ; if ratio is at minimum => p=0 => 1 x
                                                 ; if ratio is at maximum => p=0.5 => t/x => t/x*x=t
     fdiv    dword [{{.Input "compressor" "invgain"}}]; this used to be pregain but that ran into problems with getting back up to 0 dB so postgain should be better at that
+{{- if .SupportsParamValue "compressor" "sidechain" 1}}
+    test    edi, edi
+    jz      su_op_compressor_nokey
+    fstp    st1                                 ; g (r), the key is replaced by the gain
+{{- if and (.Stereo "compressor") (not (.Mono "compressor"))}}
+    fstp    st1                                 ; g
+{{- end}}
+su_op_compressor_nokey:
+{{- end}}
 {{- if and (.Stereo "compressor") (not (.Mono "compressor"))}}
     fld     st0                                 ; and return the computed gain two times, ready for MULP STEREO
 {{- end}}
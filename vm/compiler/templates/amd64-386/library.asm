@@ -4,9 +4,11 @@ struc su_synth
     .synth_wrk  resb    su_synthworkspace.size
     .delay_wrks resb    su_delayline_wrk.size * 128
     .delaytimes resw    768
+    .wavetables resb    {{.PTRSIZE}} ; pointer to the wavetable samples, only needed when the patch has wavetables
     .sampleoffs resb    su_sample_offset.size * 256
     .randseed   resd    1
     .globaltime resd    1
+    .songtime   resd    1
     .opcodes    resb    32 * 64
     .operands   resb    32 * 64 * 8
     .polyphony  resd    1
@@ -45,10 +47,14 @@ endstruc
     {{.Push .AX "SampleTable"}}
     lea     {{.AX}}, [{{.CX}} + su_synth.delaytimes]
     {{.Push .AX "DelayTable"}}
+    mov     {{.AX}}, [{{.CX}} + su_synth.wavetables]
+    {{.Push .AX "WavetableTable"}}
     mov     eax, [{{.CX}} + su_synth.randseed]
     {{.Push .AX "RandSeed"}}
     mov     eax, [{{.CX}} + su_synth.globaltime]
     {{.Push .AX "GlobalTick"}}
+    mov     eax, [{{.CX}} + su_synth.songtime]
+    {{.Push .AX "SongTick"}}
     mov     ebx, dword [{{.BX}}]           ; zero extend dereferenced pointer
     {{.Push .BX "RowLength"}}             ; the nominal rowlength should be time_in
     xor     eax, eax                   ; rowtick starts at 0
@@ -92,16 +98,20 @@ su_render_samples_loop:
         stosd   ; clear right channel so the VM is ready to write them again
         {{.Pop .AX}}
         inc     dword [{{.Stack "GlobalTick"}}] ; increment global time, used by delays
+        inc     dword [{{.Stack "SongTick"}}]   ; increment song time, used by the tempo-synced units
         jmp     su_render_samples_loop
 su_render_samples_time_finish:
     {{.Pop .CX}}
+    {{.Pop .SI}}
     {{.Pop .BX}}
     {{.Pop .DX}}
     {{.Pop .CX}}
     {{.Pop .CX}}
     {{.Pop .CX}}
+    {{.Pop .CX}}
     mov     [{{.CX}} + su_synth.randseed], edx
     mov     [{{.CX}} + su_synth.globaltime], ebx
+    mov     [{{.CX}} + su_synth.songtime], esi
     {{.Pop .BX}}
     {{.Pop .BX}}
     {{.Pop .DX}}
@@ -40,9 +40,11 @@ typedef struct Synth {
     struct SynthWorkspace SynthWrk;
     struct DelayWorkspace DelayWrks[128]; // let's keep this as 64 for now, so the delays take 16 meg. If that's too little or too much, we can change this in future.
     unsigned short DelayTimes[768];
+    unsigned short *Wavetables; // can be null, unless the patch has wavetable units
     struct SampleOffset SampleOffsets[256];
     unsigned int RandSeed;
     unsigned int GlobalTick;
+    unsigned int SongTick; // the position of the song, used by the tempo-synced units
     unsigned char Opcodes[32 * 64];
     unsigned char Operands[32 * 64 * 8];
     unsigned int Polyphony;
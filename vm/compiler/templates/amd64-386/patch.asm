@@ -214,3 +214,12 @@ su_clip_do:
 {{- range .Instructions}}
     db    {{$.TransformCount .}}
 {{- end}}
+
+{{- if .HasOp "formant"}}
+
+;-------------------------------------------------------------------------------
+; The filter coefficients of the vowels, used by the formant opcode
+;-------------------------------------------------------------------------------
+{{.Data "su_formant_table"}}
+    dw {{.FormantTable | toStrings | join ","}}
+{{- end}}
@@ -52,6 +52,10 @@ extern syncBuf
 su_render_rowloop:                      ; loop through every row in the song
         {{.Push .AX "Row"}}
         {{.Call "su_update_voices"}}   ; update instruments for the new row
+        {{- if .Lanes}}
+        mov     eax, [{{.Stack "Row"}}]
+        {{.Call "su_update_lanes"}}    ; write the values of the automation lanes to the operands
+        {{- end}}
         xor     eax, eax                ; ecx is the current sample within row
 su_render_sampleloop:                   ; loop through every sample in the row
             {{.Push .AX "Sample"}}
@@ -62,7 +66,7 @@ su_render_sampleloop:                   ; loop through every sample in the row
             mov     {{.DX}}, {{.PTRWORD}} su_synth_obj                       ; {{.DX}} points to the synth object
             mov     {{.COM}}, {{.PTRWORD}} su_patch_opcodes           ; COM points to vm code
             mov     {{.VAL}}, {{.PTRWORD}} su_patch_operands             ; VAL points to unit params
-            {{- if .HasOp "delay"}}
+            {{- if or (.HasOp "delay") (.HasOp "pluck") (.HasOp "chorus") (.HasOp "limiter") (.HasOp "reverb")}}
             mov     {{.CX}}, {{.PTRWORD}} su_synth_obj + su_synthworkspace.size - su_delayline_wrk.filtstate
             {{- end}}
             lea     {{.WRK}}, [{{.DX}} + su_synthworkspace.voices]            ; WRK points to the first voice
@@ -121,6 +125,12 @@ su_update_voices_trackloop:
         imul    eax, {{.PatternLength}}                   ; eax = offset to current pattern data
 {{- .Prepare "su_patterns" .AX | indent 4}}
         movzx   eax,byte [{{.Use "su_patterns" .AX}} + {{.DX}}]  ; eax = note
+{{- if .Transposes}}
+        cmp     al, {{.Hold}}                   ; only notes are transposed, not holds or releases
+        jbe     short su_update_voices_transposed
+        add     al, byte [{{.SI}} + {{mul (len .Sequences) .SequenceLength}}] ; add the transpose of the current pattern, stored after the sequences
+su_update_voices_transposed:
+{{- end}}
         push    {{.DX}}                                 ; Stack: ptrnrow
         xor     edx, edx                            ; edx=0
         mov     ecx, ebx                            ; ecx=first voice of the track to be done
@@ -179,6 +189,12 @@ su_update_voices_trackloop:
         imul    eax, {{.PatternLength}}           ; multiply by rows per pattern, eax = offset to current pattern data
 {{- .Prepare "su_patterns" .AX | indent 8}}
         movzx   eax, byte [{{.Use "su_patterns" .AX}} + {{.DX}}]  ; ecx = note
+{{- if .Transposes}}
+        cmp     al, {{.Hold}}                   ; only notes are transposed, not holds or releases
+        jbe     short su_update_voices_transposed
+        add     al, byte [{{.SI}} + {{mul (len .Sequences) .SequenceLength}}] ; add the transpose of the current pattern, stored after the sequences
+su_update_voices_transposed:
+{{- end}}
         cmp     al, {{.Hold}}                   ; anything but hold causes action
         je      short su_update_voices_nexttrack
         mov     dword [{{.DI}}+su_voice.sustain], eax     ; set the voice currently active to release
@@ -199,6 +215,50 @@ su_update_voices_skipadd:
     ret
 {{- end}}
 
+{{- if .Lanes}}
+
+;-------------------------------------------------------------------------------
+;   su_update_lanes function: automation lanes
+;-------------------------------------------------------------------------------
+;   Input:      eax     :   current row within song
+;   Dirty:      pretty much everything
+;-------------------------------------------------------------------------------
+{{.Func "su_update_lanes"}}
+    xor     edx, edx
+    mov     ebx, {{.PatternLength}}
+    div     ebx                                 ; eax = current pattern, edx = current row in pattern
+{{- .Prepare "su_tracks" | indent 4}}
+    lea     {{.SI}}, [{{.Use "su_tracks"}}+{{.AX}}+{{mul (len .Song.Score.Tracks) .SequenceLength}}] ; esi points to the pattern data of the first lane, after the tracks
+    xor     ebx, ebx                            ; ebx is the current lane
+su_update_lanes_loop:
+        movzx   eax, byte [{{.SI}}]                     ; eax = current pattern
+        imul    eax, {{.PatternLength}}           ; multiply by rows per pattern, eax = offset to current pattern data
+{{- .Prepare "su_patterns" .AX | indent 8}}
+        movzx   eax, byte [{{.Use "su_patterns" .AX}} + {{.DX}}]  ; eax = value
+{{- if .Transposes}}
+        cmp     al, {{.Hold}}                   ; only values are transposed, not holds or releases
+        jbe     short su_update_lanes_transposed
+        add     al, byte [{{.SI}} + {{mul (len .Sequences) .SequenceLength}}] ; add the transpose of the current pattern, stored after the sequences
+su_update_lanes_transposed:
+{{- end}}
+        cmp     al, {{.Hold}}                   ; hold keeps the current value
+        je      short su_update_lanes_next
+{{- .Prepare "su_lane_operands" | indent 8}}
+        movzx   ecx, word [{{.Use "su_lane_operands"}} + {{.BX}}*2] ; ecx = index of the operand set by the lane
+        ja      short su_update_lanes_write         ; lea and movzx do not change the flags
+{{- .Prepare "su_lane_values" | indent 8}}
+        mov     al, byte [{{.Use "su_lane_values"}} + {{.BX}}] ; release restores the value in the patch
+su_update_lanes_write:
+{{- .Prepare "su_patch_operands" | indent 8}}
+        mov     byte [{{.Use "su_patch_operands"}} + {{.CX}}], al
+su_update_lanes_next:
+        add     {{.SI}}, {{.SequenceLength}}
+        inc     ebx
+        cmp     ebx, {{len .Lanes}}
+        jl      su_update_lanes_loop
+    ret
+{{- end}}
+
 {{template "patch.asm" .}}
 
 ;-------------------------------------------------------------------------------
@@ -216,6 +276,12 @@ su_update_voices_skipadd:
 {{- range .Sequences}}
     db {{. | toStrings | join ","}}
 {{- end}}
+{{- if .Transposes}}
+; Transposes of the patterns in the tracks
+{{- range .Transposes}}
+    db {{. | toStrings | join ","}}
+{{- end}}
+{{- end}}
 
 {{- if gt (.SampleOffsets | len) 0}}
 ;-------------------------------------------------------------------------------
@@ -237,6 +303,28 @@ su_update_voices_skipadd:
     dw {{.DelayTimes | toStrings | join ","}}
 {{end}}
 
+{{- if .Lanes}}
+;-------------------------------------------------------------------------------
+;    Automation lanes: the operands they set and the values in the patch
+;-------------------------------------------------------------------------------
+{{.Data "su_lane_operands"}}
+{{- range .Lanes}}
+    dw {{.Operand}}
+{{- end}}
+{{.Data "su_lane_values"}}
+{{- range .Lanes}}
+    db {{.Value}}
+{{- end}}
+{{end}}
+
+{{- if gt (.Wavetables | len ) 0}}
+;-------------------------------------------------------------------------------
+;    Wavetables
+;-------------------------------------------------------------------------------
+{{.Data "su_wavetables"}}
+    dw {{.Wavetables | toStrings | join ","}}
+{{end}}
+
 ;-------------------------------------------------------------------------------
 ;    The code for this patch, basically indices to vm jump table
 ;-------------------------------------------------------------------------------
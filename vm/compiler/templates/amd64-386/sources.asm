@@ -1,9 +1,13 @@
 {{if .HasOp "envelope" -}}
+{{- $curves := or (.SupportsParamValueOtherThan "envelope" "attackcurve" 0) (.SupportsParamValueOtherThan "envelope" "decaycurve" 0) (.SupportsParamValueOtherThan "envelope" "releasecurve" 0)}}
 ;-------------------------------------------------------------------------------
 ;   ENVELOPE opcode: pushes an ADSR envelope value on stack [0,1]
 ;-------------------------------------------------------------------------------
 ;   Mono:   push the envelope value on stack
 ;   Stereo: push the envelope valeu on stack twice
+;   Curves: the step of a segment is multiplied by 1+c*(2*d-1), where d is the
+;           remaining distance to the end of the segment divided by the span of
+;           the segment (1, 1-sustain or the level where the release started)
 ;-------------------------------------------------------------------------------
 {{.Func "su_op_envelope" "Opcode"}}
 {{- if .StereoAndMono "envelope"}}
@@ -14,21 +18,70 @@
     fld     st0
     ret
 su_op_envelope_mono:
+{{- end}}
+{{- if $curves}}
+    add     {{.VAL}}, 3                         ; skip the curve operands, they are read relative to the new VAL below
 {{- end}}
     mov     eax, dword [{{.INP}}-su_voice.inputs+su_voice.sustain] ; eax = su_instrument.sustain
     test    eax, eax                            ; if (eax != 0)
     jne     su_op_envelope_process              ;   goto process
     mov     al, {{.InputNumber "envelope" "release"}}  ; [state]=RELEASE
+{{- if $curves}}
+    cmp     dword [{{.WRK}}], eax               ; if (state != RELEASE)
+    je      su_op_envelope_process
+    mov     ecx, dword [{{.WRK}}+4]
+    mov     dword [{{.WRK}}+8], ecx             ;   [start]=[level], the level where the release started
+{{- end}}
     mov     dword [{{.WRK}}], eax               ; note that mov al, XXX; mov ..., eax is less bytes than doing it directly
 su_op_envelope_process:
     mov     eax, dword [{{.WRK}}]  ; al=[state]
     fld     dword [{{.WRK}}+4]       ; x=[level]
     cmp     al, {{.InputNumber "envelope" "sustain"}}               ; if (al==SUSTAIN)
-    je      short su_op_envelope_leave2         ;   goto leave2
+    je      su_op_envelope_leave2               ;   goto leave2
+{{- if $curves}}
+    fld1                                        ; 1 x
+    fld     st1                                 ; x 1 x
+    cmp     al, {{.InputNumber "envelope" "attack"}}                 ; if (al==ATTAC)
+    jne     short su_op_envelope_curve_decay
+    fsubr   st0, st1                            ; d w x, where d=1-x and w=1
+    jmp     short su_op_envelope_curve
+su_op_envelope_curve_decay:
+    cmp     al, {{.InputNumber "envelope" "decay"}}                 ; if (al==DECAY)
+    jne     short su_op_envelope_curve_release
+    fld     dword [{{.Input "envelope" "sustain"}}]    ; s x 1 x
+    fsub    st2, st0                            ; s x 1-s x
+    fsubp   st1, st0                            ; d w x, where d=x-s and w=1-s
+    jmp     short su_op_envelope_curve
+su_op_envelope_curve_release:
+    fld     dword [{{.WRK}}+8]                  ; l x 1 x
+    fstp    st2                                 ; d w x, where d=x and w=l, the level where the release started
+su_op_envelope_curve:                           ; d w x, where w is the span of the segment
+    fxch                                        ; w d x
+{{- .Float 0.00000095367431640625 | .Prepare | indent 4}}
+    fadd    dword [{{.Float 0.00000095367431640625 | .Use}}] ; w+e d x, where e avoids dividing by zero
+    fdivp   st1, st0                            ; d/(w+e) x
+    fadd    st0, st0                            ; 2*d x
+    fld1                                        ; 1 2*d x
+    fsubp   st1, st0                            ; 2*d-1 x
+    lea     ecx, [eax+1]
+    shr     ecx, 1                              ; ecx = 0, 1 or 2 for attack, decay or release
+    movzx   ecx, byte [{{.VAL}}+{{.CX}}-3]      ; ecx = curve+64
+    sub     ecx, 64
+    push    {{.CX}}
+    fimul   dword [{{.SP}}]                     ; curve*(2*d-1) x
+    pop     {{.CX}}
+    {{- .Float 0.0146484375 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.0146484375 | .Use}}] ; c*(2*d-1) x, where c=curve*15/1024
+    fld1                                        ; 1 c*(2*d-1) x
+    faddp   st1, st0                            ; m x, where m=1+c*(2*d-1)
+{{- end}}
 su_op_envelope_attac:
     cmp     al, {{.InputNumber "envelope" "attack"}}                 ; if (al!=ATTAC)
     jne     short su_op_envelope_decay          ;   goto decay
     {{.Call "su_nonlinear_map"}}                ; a x, where a=attack
+{{- if $curves}}
+    fmulp   st1, st0                            ; a*m x
+{{- end}}
     faddp   st1, st0                            ; a+x
     fld1                                        ; 1 a+x
     fucomi  st1                                 ; if (a+x<=1) // is attack complete?
@@ -38,6 +91,9 @@ su_op_envelope_decay:
     cmp     al, {{.InputNumber "envelope" "decay"}}                 ; if (al!=DECAY)
     jne     short su_op_envelope_release        ;   goto release
     {{.Call "su_nonlinear_map"}}                ; d x, where d=decay
+{{- if $curves}}
+    fmulp   st1, st0                            ; d*m x
+{{- end}}
     fsubp   st1, st0                            ; x-d
     fld     dword [{{.Input "envelope" "sustain"}}]    ; s x-d, where s=sustain
     fucomi  st1                                 ; if (x-d>s) // is decay complete?
@@ -47,6 +103,9 @@ su_op_envelope_release:
     cmp     al, {{.InputNumber "envelope" "release"}}               ; if (al!=RELEASE)
     jne     short su_op_envelope_leave          ;   goto leave
     {{.Call "su_nonlinear_map"}}                ; r x, where r=release
+{{- if $curves}}
+    fmulp   st1, st0                            ; r*m x
+{{- end}}
     fsubp   st1, st0                            ; x-r
     fldz                                        ; 0 x-r
     fucomi  st1                                 ; if (x-r>0) // is release complete?
@@ -91,6 +150,96 @@ su_op_noise_mono:
 {{end}}
 
 
+{{- if .HasOp "ramp"}}
+;-------------------------------------------------------------------------------
+;   RAMP opcode: the position of the song within a tempo-synced period
+;-------------------------------------------------------------------------------
+;   Mono:   push the ramp value [0,1] on stack
+;   Stereo: push the ramp value twice on stack
+;-------------------------------------------------------------------------------
+{{.Func "su_op_ramp" "Opcode"}}
+{{- if .Library}}
+    fild    dword [{{.Stack "SongTick"}}]       ; t, the position of the song
+{{- else}}
+    fild    dword [{{.Stack "GlobalTick"}}]     ; t
+{{- end}}
+    fmul    dword [{{.VAL}}]                    ; t*i, where i is the number of periods per sample
+    lodsd                                       ; advance {{.VAL}} past the increment, without touching the flags
+    fadd    dword [{{.Input "ramp" "phase"}}]   ; x=t*i+p
+    fld     st0                                 ; x x
+{{- .Prepare (.Float 0.5)}}
+    fsub    dword [{{.Use (.Float 0.5)}}]      ; x-.5 x
+    frndint                                     ; n x, where n is the number of full periods
+    fsubp   st1, st0                            ; x-n
+    fmul    dword [{{.Input "ramp" "gain"}}]    ; g*(x-n)
+{{- if .StereoAndMono "ramp"}}
+    jnc     su_op_ramp_mono
+{{- end}}
+{{- if .Stereo "ramp"}}
+    fld     st0
+{{- end}}
+{{- if .StereoAndMono "ramp"}}
+su_op_ramp_mono:
+{{- end}}
+    ret
+{{end}}
+
+
+{{- if .HasOp "random"}}
+;-------------------------------------------------------------------------------
+;   RANDOM opcode: sample and hold a random value, with optional smoothing
+;-------------------------------------------------------------------------------
+;   Mono:   push the held random value on stack
+;   Stereo: push two (different) held random values on stack
+;-------------------------------------------------------------------------------
+{{.Func "su_op_random" "Opcode"}}
+{{- if .Library}}
+    fild    dword [{{.Stack "SongTick"}}]       ; t, the position of the song
+{{- else}}
+    fild    dword [{{.Stack "GlobalTick"}}]     ; t
+{{- end}}
+    fmul    dword [{{.VAL}}]                    ; t*i, where i is the step increment per sample
+    lodsd                                       ; advance {{.VAL}} past the increment, without touching the flags
+{{- .Prepare (.Float 0.5)}}
+    fsub    dword [{{.Use (.Float 0.5)}}]      ; t*i-.5
+    frndint                                     ; s, the index of the current step
+    lea     {{.CX}},[{{.Stack "RandSeed"}}]
+{{- if .StereoAndMono "random"}}
+    jnc     su_op_random_mono
+{{- end}}
+{{- if .Stereo "random"}}
+    fld     st0                                 ; s s
+    add     {{.WRK}}, 16
+    call    su_op_random_mono                   ; y' s
+    sub     {{.WRK}}, 16
+    fxch                                        ; s y'
+su_op_random_mono:
+{{- end}}
+    fld1                                        ; 1 s
+    faddp   st1, st0                            ; s+1, so that a fresh unit always draws a value
+    fld     dword [{{.WRK}}]                    ; o s+1, where o is the step of the held value
+    fucomip st1                                 ; s+1
+    fstp    dword [{{.WRK}}]                    ; (empty), fstp does not touch the flags
+    je      short su_op_random_hold
+    imul    eax, [{{.CX}}],16007
+    mov     [{{.CX}}],eax
+    fild    dword [{{.CX}}]
+{{- .Prepare (.Int 2147483648)}}
+    fidiv   dword [{{.Use (.Int 2147483648)}}] ; r
+    fstp    dword [{{.WRK}}+4]                  ; (empty)
+su_op_random_hold:
+    fld     dword [{{.WRK}}+4]                  ; h, the held value
+    fsub    dword [{{.WRK}}+8]                  ; h-y
+    mov     eax, {{.InputNumber "random" "smooth"}}
+    {{.Call "su_nonlinear_map"}}                ; a h-y
+    fmulp   st1, st0                            ; a*(h-y)
+    fadd    dword [{{.WRK}}+8]                  ; y+a*(h-y) = y'
+    fst     dword [{{.WRK}}+8]
+    fmul    dword [{{.Input "random" "gain"}}]  ; g*y'
+    ret
+{{end}}
+
+
 {{- if .HasOp "oscillator"}}
 ;-------------------------------------------------------------------------------
 ;   OSCILLAT opcode: oscillator, the heart of the synth
@@ -185,6 +334,16 @@ su_op_oscillat_normalize_note:
 {{- .Float 0.000092696138 | .Prepare}}
     fmul    dword [{{.Float 0.000092696138 | .Use}}]   ; // st0 is now frequency
 su_op_oscillat_normalized:
+{{- if (or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA))}}
+    {{.Push .AX "OscAAFlags"}}
+    {{.Push .AX "OscAATemp"}}               ; a temporary for the anti-aliased oscillators
+{{- .Float 0.5 | .Prepare}}
+    fld     dword [{{.Float 0.5 | .Use}}]   ; .5 f
+    fucomi  st1                             ; if .5 >= f
+    fcmovnb st0, st1                        ;   then f -> .5
+    {{.Push .AX "OscAADt"}}
+    fstp    dword [{{.SP}}]                 ; f, dt=min(f,.5) is needed by the anti-aliased oscillators
+{{- end}}
     fadd    dword [{{.WRK}}]
 {{- if .SupportsModulation "oscillator" "frequency"}}
     push    {{.CX}}
@@ -224,16 +383,38 @@ su_op_oscillat_not_sample:
     {{.Call "su_oscillat_sine"}}
 su_op_oscillat_notsine:
 {{- end}}
-{{- if .SupportsParamValue "oscillator" "type" .Trisaw}}
+{{- if or (.SupportsParamValue "oscillator" "type" .Trisaw) (.SupportsParamValue "oscillator" "type" .TrisawAA)}}
     test    al, byte 0x20
     jz      short su_op_oscillat_not_trisaw
+{{- if .SupportsParamValue "oscillator" "type" .TrisawAA}}
+{{- if .SupportsParamValue "oscillator" "type" .Trisaw}}
+    test    al, byte 0x04                   ; gate bit together with trisaw bit means anti-aliased
+    jz      short su_op_oscillat_trisaw_naive
+{{- end}}
+    {{.Call "su_oscillat_trisaw_aa"}}
+    jmp     su_op_oscillat_shaping
+{{- end}}
+{{- if .SupportsParamValue "oscillator" "type" .Trisaw}}
+su_op_oscillat_trisaw_naive:
     {{.Call "su_oscillat_trisaw"}}
+{{- end}}
 su_op_oscillat_not_trisaw:
 {{- end}}
-{{- if .SupportsParamValue "oscillator" "type" .Pulse}}
+{{- if or (.SupportsParamValue "oscillator" "type" .Pulse) (.SupportsParamValue "oscillator" "type" .PulseAA)}}
     test    al, byte 0x10
     jz      short su_op_oscillat_not_pulse
+{{- if .SupportsParamValue "oscillator" "type" .PulseAA}}
+{{- if .SupportsParamValue "oscillator" "type" .Pulse}}
+    test    al, byte 0x04                   ; gate bit together with pulse bit means anti-aliased
+    jz      short su_op_oscillat_pulse_naive
+{{- end}}
+    {{.Call "su_oscillat_pulse_aa"}}
+    jmp     su_op_oscillat_shaping
+{{- end}}
+{{- if .SupportsParamValue "oscillator" "type" .Pulse}}
+su_op_oscillat_pulse_naive:
     {{.Call "su_oscillat_pulse"}}
+{{- end}}
 su_op_oscillat_not_pulse:
 {{- end}}
 {{- if .SupportsParamValue "oscillator" "type" .Gate}}
@@ -249,6 +430,122 @@ su_op_oscillat_shaping:
     {{.Call "su_waveshaper"}}
 su_op_oscillat_gain:
     fmul    dword [{{.Input "oscillator" "gain"}}]
+{{- if (or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA))}}
+    {{.Pop .AX}}
+    {{.Pop .AX}}
+    {{.Pop .AX}}                            ; restore the flags
+{{- end}}
+    ret
+{{end}}
+
+
+{{- if .HasCall "su_oscillat_trisaw_aa"}}
+;-------------------------------------------------------------------------------
+;   su_oscillat_trisaw_aa: trisaw with the corners smoothed using polyBLAMP
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   color c
+;               st1     :   phase p
+;   Output:     st0     :   oscillator value
+;-------------------------------------------------------------------------------
+{{.Func "su_oscillat_trisaw_aa"}}
+    fld     dword [{{.Stack "OscAADt"}}]    ; dt c p
+    fucomi  st1                             ; if dt < c
+    fcmovb  st0, st1                        ;   then dt -> c
+    fstp    st1                             ; c'=max(c,dt) p
+    fld1                                    ; 1 c' p
+    fsub    dword [{{.Stack "OscAADt"}}]    ; 1-dt c' p
+    fucomi  st1                             ; if 1-dt >= c'
+    fcmovnb st0, st1                        ;   then 1-dt -> c'
+    fstp    st1                             ; c=min(c',1-dt) p, so both slopes are at least one sample long
+    fld     st1                             ; p c p
+    fsub    st0, st1                        ; p-c c p
+    {{.Call "su_oscillat_blep"}}            ; uc c p
+    fabs
+    fld     st0
+    fmul    st0, st0
+    fmulp   st1, st0                        ; uc^3 c p
+    fstp    dword [{{.Stack "OscAATemp"}}]  ; c p
+    fld     st1                             ; p c p
+    {{.Call "su_oscillat_blep"}}            ; u0 c p
+    fabs
+    fld     st0
+    fmul    st0, st0
+    fmulp   st1, st0                        ; u0^3 c p
+    fsub    dword [{{.Stack "OscAATemp"}}]  ; u0^3-uc^3 c p
+    fmul    dword [{{.Stack "OscAADt"}}]    ; dt*(u0^3-uc^3) c p
+    fld1                                    ; 1 d c p
+    fsub    st0, st2                        ; 1-c d c p
+    fmul    st0, st2                        ; c*(1-c) d c p
+    fdivp   st1, st0                        ; d/(c*(1-c)) c p, the slopes change by 2/(c*(1-c)) at the corners
+{{- .Float 0.33333333 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.33333333 | .Use}}] ; r c p, as the integrated polyBLEP residual is u^3/6
+    fxch    st2                             ; p c r
+    fxch                                    ; c p r
+    {{.Call "su_oscillat_trisaw"}}          ; t r
+    faddp   st1, st0                        ; t+r
+    ret
+{{end}}
+
+
+{{- if .HasCall "su_oscillat_pulse_aa"}}
+;-------------------------------------------------------------------------------
+;   su_oscillat_pulse_aa: pulse with the edges smoothed using polyBLEP
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   color c
+;               st1     :   phase p
+;   Output:     st0     :   oscillator value
+;-------------------------------------------------------------------------------
+{{.Func "su_oscillat_pulse_aa"}}
+    fld     st1                             ; p c p
+    fsub    st0, st1                        ; p-c c p
+    {{.Call "su_oscillat_blep"}}            ; uc c p
+    fld     st0
+    fabs
+    fmulp   st1, st0                        ; uc*|uc| c p
+    fstp    dword [{{.Stack "OscAATemp"}}]  ; c p
+    fld     st1                             ; p c p
+    {{.Call "su_oscillat_blep"}}            ; u0 c p
+    fld     st0
+    fabs
+    fmulp   st1, st0                        ; u0*|u0| c p
+    fsubr   dword [{{.Stack "OscAATemp"}}]  ; r c p, as the polyBLEP residual of a step of height 2 is u*|u|
+    fxch    st2                             ; p c r
+    fxch                                    ; c p r
+    {{.Call "su_oscillat_pulse"}}           ; s r
+    faddp   st1, st0                        ; s+r
+    ret
+{{end}}
+
+
+{{- if .HasCall "su_oscillat_blep"}}
+;-------------------------------------------------------------------------------
+;   su_oscillat_blep: distance to a discontinuity, for polyBLEP and polyBLAMP
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   x, phase minus the phase of the discontinuity
+;   Output:     st0     :   sign(w)*max(1-|w|/dt,0), where w is x wrapped to
+;                           [-.5,.5]
+;-------------------------------------------------------------------------------
+{{.Func "su_oscillat_blep"}}
+    fld     st0                             ; x x
+    frndint                                 ; round(x) x
+    fsubp   st1, st0                        ; w
+    {{.Push .AX "OscBlepFlags"}}
+    {{.Push .AX "OscBlepW"}}
+    fst     dword [{{.SP}}]                 ; store w so we can check its sign later
+    fabs                                    ; |w|
+    fdiv    dword [{{.Stack "OscAADt"}}]    ; |w|/dt
+    fld1                                    ; 1 |w|/dt
+    fsubrp  st1, st0                        ; u=1-|w|/dt
+    fldz                                    ; 0 u
+    fucomi  st1                             ; if 0 < u
+    fcmovb  st0, st1                        ;   then 0 -> u
+    fstp    st1                             ; max(u,0)
+    {{.Pop .AX}}                            ; eax = w
+    test    eax, eax
+    {{.Pop .AX}}                            ; restore the flags of the oscillator
+    jns     short su_oscillat_blep_positive
+    fchs
+su_oscillat_blep_positive:
     ret
 {{end}}
 
@@ -364,6 +661,223 @@ su_oscillat_sample_not_looping:
 {{end}}
 
 
+{{- if .HasOp "wavetable"}}
+;-------------------------------------------------------------------------------
+;   WAVETABLE opcode: oscillator playing user defined single cycle waveforms
+;-------------------------------------------------------------------------------
+;   Mono:   push the wavetable value on stack, interpolated linearly between
+;           the samples and between the two frames around the position
+;   Stereo: push l r on stack, where l has opposite detune compared to r
+;-------------------------------------------------------------------------------
+{{.Func "su_op_wavetable" "Opcode"}}
+    lodsw                                   ; ax = index of the first sample in the wavetable table
+    movzx   edi, ax
+    lodsw                                   ; al = length of a frame, ah = frames-1, note that the flags are untouched
+    {{- .PushRegs .VAL "WavetableVal" .COM "WavetableCom" | indent 4}}
+{{- if .Library}}
+    mov     {{.SI}}, [{{.Stack "WavetableTable"}}] ; when using runtime tables, wavetables are pulled from the stack so can be a pointer to heap
+    lea     {{.BX}}, [{{.SI}} + {{.DI}}*2]
+{{- else}}
+{{- .Prepare "su_wavetables" | indent 4}}
+    lea     {{.BX}}, [{{.Use "su_wavetables"}} + {{.DI}}*2] ; BX points to the first sample of the wavetable
+{{- end}}
+    fld     dword [{{.Input "wavetable" "detune"}}] ; e, where e is the detune [0,1]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]   ; e-.5
+    fadd    st0, st0                        ; d=2*(e-.5), where d is the detune [-1,1]
+{{- if .StereoAndMono "wavetable"}}
+    jnc     su_op_wavetable_mono
+{{- end}}
+{{- if .Stereo "wavetable"}}
+    fld     st0                             ; d d
+    add     {{.WRK}}, 4                     ; move wrk...
+    call    su_op_wavetable_do              ; r d
+    sub     {{.WRK}}, 4                     ; ...restore wrk
+    fxch                                    ; d r
+    fchs                                    ; -d r, negate the detune for second round
+su_op_wavetable_mono:
+{{- end}}
+    call    su_op_wavetable_do
+    {{- .PopRegs .VAL .COM | indent 4}}
+    ret
+
+;-------------------------------------------------------------------------------
+;   su_op_wavetable_do: computes one channel of the wavetable oscillator
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   d, the detune [-1,1]
+;               al      :   length of a frame
+;               ah      :   frames-1
+;               BX      :   pointer to the first sample of the wavetable
+;   Output:     st0     :   the wavetable value
+;   Dirty:      CX, SI, DI
+;-------------------------------------------------------------------------------
+{{.Func "su_op_wavetable_do"}}
+    fld     dword [{{.Input "wavetable" "transpose"}}]
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]
+{{- .Float 0.0078125 | .Prepare | indent 4}}
+    fdiv    dword [{{.Float 0.0078125 | .Use}}]
+    faddp   st1
+    fiadd   dword [{{.INP}}-su_voice.inputs+su_voice.note]   ; t+d+n
+{{- .Int 0x3DAAAAAA | .Prepare | indent 4}}
+    fmul    dword [{{.Int 0x3DAAAAAA | .Use}}]
+    {{.Call "su_power"}}
+{{- .Float 0.000092696138 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.000092696138 | .Use}}]   ; f, the frequency
+    fadd    dword [{{.WRK}}]                ; p+f
+    fld1                                    ; take mod(p+f,1), see oscillator for details
+    fadd    st1, st0
+    fxch
+    fprem
+    fstp    st1
+    fst     dword [{{.WRK}}]                ; p, store back the updated phase
+    fld     dword [{{.Input "wavetable" "position"}}] ; q p
+    fldz                                    ; 0 q p
+    fucomi  st1                             ; if 0 < q
+    fcmovb  st0, st1                        ;   then q -> 0
+    fstp    st1                             ; q'=max(q,0) p
+    fld1                                    ; 1 q' p
+    fucomi  st1                             ; if 1 >= q'
+    fcmovnb st0, st1                        ;   then q' -> 1
+    fstp    st1                             ; q''=min(q',1) p
+    movzx   ecx, ah
+    push    {{.CX}}
+    fimul   dword [{{.SP}}]                 ; y=q''*(frames-1) p
+    pop     {{.CX}}
+    {{.Call "su_wavetable_split"}}          ; fy p, ecx = j, the frame
+    {{.Push .CX "WavetableFy"}}
+    fstp    dword [{{.SP}}]                 ; p, fy is kept in the stack
+    cmp     cl, ah                          ; if j < frames-1
+    sbb     esi, esi                        ;   then esi = -1 else esi = 0
+    movzx   edi, al                         ; edi = length
+    and     esi, edi                        ; esi = offset to the next frame, 0 for the last frame
+    imul    ecx, edi                        ; ecx = j*length
+    push    {{.DI}}
+    fimul   dword [{{.SP}}]                 ; x=p*length
+    pop     {{.DI}}
+    lea     {{.DI}}, [{{.BX}} + {{.CX}}*2]  ; DI points to the frame j
+    {{.Call "su_wavetable_split"}}          ; fx, ecx = i, the sample
+    {{.Call "su_wavetable_lerp"}}           ; a fx, interpolated value from frame j
+    fxch                                    ; fx a
+    lea     {{.DI}}, [{{.DI}} + {{.SI}}*2]  ; DI points to the frame j+1
+    {{.Call "su_wavetable_lerp"}}           ; b fx a
+    fstp    st1                             ; b a
+    fsub    st0, st1                        ; b-a a
+    fmul    dword [{{.Stack "WavetableFy"}}] ; (b-a)*fy a
+    faddp   st1, st0                        ; s=a+(b-a)*fy
+    {{.Pop .CX}}
+    fmul    dword [{{.Input "wavetable" "gain"}}] ; g*s
+{{- .Float 0.0078125 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.0078125 | .Use}}] ; g*s/128, as the samples are -128...127
+    ret
+
+;-------------------------------------------------------------------------------
+;   su_wavetable_split: splits x into integer and fractional parts
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   x >= 0
+;   Output:     st0     :   x-round(x-.5), which is in [0,1]
+;               ecx     :   round(x-.5)
+;-------------------------------------------------------------------------------
+{{.Func "su_wavetable_split"}}
+    fld     st0                             ; x x
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fsub    dword [{{.Float 0.5 | .Use}}]   ; x-.5 x
+    push    0
+    fistp   dword [{{.SP}}]                 ; x, [SP] = i
+    fisub   dword [{{.SP}}]                 ; x-i
+    pop     {{.CX}}                         ; ecx = i
+    ret
+
+;-------------------------------------------------------------------------------
+;   su_wavetable_lerp: interpolates linearly between two samples of a frame
+;-------------------------------------------------------------------------------
+;   Input:      st0     :   fractional part f
+;               ecx     :   sample index i
+;               al      :   length of the frame
+;               DI      :   pointer to the frame
+;   Output:     st0     :   s[i]+(s[i+1]-s[i])*f, where i+1 wraps around
+;               st1     :   f
+;-------------------------------------------------------------------------------
+{{.Func "su_wavetable_lerp"}}
+    fild    word [{{.DI}} + {{.CX}}*2]      ; s0 f
+    push    {{.CX}}
+    inc     ecx                             ; i+1
+    cmp     cl, al                          ; if i+1 >= length
+    jb      short su_wavetable_lerp_nowrap
+    xor     ecx, ecx                        ;   then wrap to the first sample
+su_wavetable_lerp_nowrap:
+    fild    word [{{.DI}} + {{.CX}}*2]      ; s1 s0 f
+    pop     {{.CX}}
+    fsub    st0, st1                        ; s1-s0 s0 f
+    fmul    st0, st2                        ; (s1-s0)*f s0 f
+    faddp   st1, st0                        ; s f
+    ret
+{{end}}
+
+
+{{- if .HasOp "operator"}}
+;-------------------------------------------------------------------------------
+;   OPERATOR opcode: sine oscillator with phase modulation input, for FM
+;-------------------------------------------------------------------------------
+;   Mono:   x   ->  g*sin(2*pi*(p+x+f*(y1+y2)/4)), where p is the phase and
+;                   y1, y2 are the two previous outputs before the gain
+;   Stereo: l r ->  the same for both channels, with separate phases
+;-------------------------------------------------------------------------------
+{{.Func "su_op_operator" "Opcode"}}
+    lodsb                                   ; load the flags to al
+{{- if .Stereo "operator"}}
+    {{.Call "su_effects_stereohelper"}}
+{{- end}}
+    fild    dword [{{.INP}}-su_voice.inputs+su_voice.note] ; n x
+{{- if .SupportsParamValue "operator" "fixed" 1}}
+    test    al, al                          ; if the fixed bit is not set
+    jns     short su_op_operator_ratio      ;   then keep the note
+    fstp    st0
+{{- .Int 72 | .Prepare | indent 4}}
+    fild    dword [{{.Int 72 | .Use}}]      ; else n = 72, the middle C
+su_op_operator_ratio:
+{{- end}}
+{{- .Int 0x3DAAAAAA | .Prepare | indent 4}}
+    fmul    dword [{{.Int 0x3DAAAAAA | .Use}}] ; n/12 x
+    {{.Call "su_power"}}                    ; 2^(n/12) x
+{{- .Float 0.000092696138 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.000092696138 | .Use}}] ; f x, the frequency of the note
+    movzx   ecx, al
+    and     ecx, 0x7f                       ; ecx = 2*r, where r is the coarse ratio
+    push    {{.CX}}
+    fimul   dword [{{.SP}}]                 ; 2*r*f x
+    pop     {{.CX}}
+    fld1                                    ; 1 2*r*f x
+    fadd    dword [{{.Input "operator" "fine"}}] ; 1+e 2*r*f x, where e is the fine ratio
+    fmulp   st1, st0                        ; 2*r*(1+e)*f x
+{{- .Float 0.5 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.5 | .Use}}]   ; w x, w = r*(1+e)*f is the phase increment
+    fadd    dword [{{.WRK}}]                ; p+w x
+    fld1                                    ; take mod(p+w,1), see oscillator for details
+    fadd    st1, st0
+    fxch
+    fprem
+    fstp    st1
+    fst     dword [{{.WRK}}]                ; p x, store back the updated phase
+    faddp   st1, st0                        ; p+x
+    fld     dword [{{.WRK}}+4]              ; y1 p+x
+    fadd    dword [{{.WRK}}+8]              ; y1+y2 p+x
+    fmul    dword [{{.Input "operator" "feedback"}}] ; f*(y1+y2) p+x
+{{- .Float 0.25 | .Prepare | indent 4}}
+    fmul    dword [{{.Float 0.25 | .Use}}]  ; f*(y1+y2)/4 p+x
+    faddp   st1, st0                        ; q = p+x+f*(y1+y2)/4
+    fldpi                                   ; pi q
+    fadd    st0                             ; 2*pi q
+    fmulp   st1, st0                        ; 2*pi*q
+    fsin                                    ; y = sin(2*pi*q)
+    fld     dword [{{.WRK}}+4]              ; y1 y
+    fstp    dword [{{.WRK}}+8]              ; y, y2 <- y1
+    fst     dword [{{.WRK}}+4]              ; y, y1 <- y
+    fmul    dword [{{.Input "operator" "gain"}}] ; g*y
+    ret
+{{end}}
+
+
 {{- if .HasOp "loadval"}}
 ;-------------------------------------------------------------------------------
 ;   LOADVAL opcode
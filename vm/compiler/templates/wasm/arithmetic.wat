@@ -199,7 +199,7 @@
 {{end}}
 
 
-{{- if or (.HasOp "xch") (.Stereo "delay")}}
+{{- if or (.HasOp "xch") (.Stereo "delay") (.Stereo "pluck") (.Stereo "chorus")}}
 ;;-------------------------------------------------------------------------------
 ;;   XCH opcode: exchange the signals on the stack
 ;;-------------------------------------------------------------------------------
@@ -227,7 +227,7 @@
 {{- if .StereoAndMono "xch"}}
     )(else
 {{- end}}
-{{- if or (.Mono "xch") (.Stereo "delay")}}
+{{- if or (.Mono "xch") (.Stereo "delay") (.Stereo "pluck") (.Stereo "chorus")}}
         call $swap
 {{- end}}
 {{- if .StereoAndMono "xch"}}
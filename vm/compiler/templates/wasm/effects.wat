@@ -203,6 +203,210 @@
 {{end}}
 
 
+{{- if .HasOp "formant"}}
+;;-------------------------------------------------------------------------------
+;;   FORMANT opcode: vowel filter, two parallel band-passes at the formants
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  r*(b1+g*b2), where b1 and b2 are the band-passed signals
+;;   Stereo: l r ->  the same for both channels
+;;   The formant frequencies and the gain g are interpolated from the formant
+;;   table.
+;;-------------------------------------------------------------------------------
+(func $su_op_formant (param $stereo i32) (local $table i32) (local $pos f32) (local $vowel i32) (local $i i32) (local $x f32) (local $out f32) (local $low f32) (local $band f32) (local $c0 f32) (local $c1 f32)
+{{- if .Stereo "formant"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "formant") 2}}))
+{{- end}}
+    (local.set $pos (f32.mul ;; p=2*(clip(2*v-1)+1) is the position in the table [0,4]
+        (f32.add
+            (call $clip (call $inputSigned (i32.const {{.InputNumber "formant" "vowel"}})))
+            (f32.const 1)
+        )
+        (f32.const 2)
+    ))
+    (local.set $vowel (i32.trunc_f32_s (f32.nearest (f32.sub (local.get $pos) (f32.const 0.5)))))
+    (if (i32.gt_s (local.get $vowel) (i32.const 3)) (then (local.set $vowel (i32.const 3))))
+    (local.set $pos (f32.sub (local.get $pos) (f32.convert_i32_s (local.get $vowel)))) ;; the fraction between vowels i and i+1
+    (local.set $table (i32.add
+        (i32.const {{index .Labels "su_formant_table"}})
+        (i32.mul (local.get $vowel) (i32.const 6))
+    ))
+    (local.set $c0 (call $formant_coef (local.get $table) (local.get $pos)))
+    (local.set $c1 (call $formant_coef (i32.add (local.get $table) (i32.const 2)) (local.get $pos)))
+    (local.set $x (call $pop))
+    loop $filterloop
+        (local.set $low (f32.add ;; l' = l + c*b
+            (f32.load (i32.add (global.get $WRK) (i32.shl (local.get $i) (i32.const 3))))
+            (f32.mul
+                (select (local.get $c1) (local.get $c0) (local.get $i))
+                (local.tee $band (f32.load offset=4 (i32.add (global.get $WRK) (i32.shl (local.get $i) (i32.const 3)))))
+            )
+        ))
+        (local.set $band (f32.add ;; b' = b + c*(x-l'-r*b)
+            (local.get $band)
+            (f32.mul
+                (select (local.get $c1) (local.get $c0) (local.get $i))
+                (f32.sub
+                    (f32.sub (local.get $x) (local.get $low))
+                    (f32.mul (call $input (i32.const {{.InputNumber "formant" "resonance"}})) (local.get $band))
+                )
+            )
+        ))
+        (f32.store (i32.add (global.get $WRK) (i32.shl (local.get $i) (i32.const 3))) (local.get $low))
+        (f32.store offset=4 (i32.add (global.get $WRK) (i32.shl (local.get $i) (i32.const 3))) (local.get $band))
+        (if (local.get $i) (then
+            (local.set $band (f32.mul (local.get $band) (call $formant_coef (i32.add (local.get $table) (i32.const 4)) (local.get $pos)))) ;; the gain of the second formant
+        ))
+        (local.set $out (f32.add (local.get $out) (local.get $band)))
+        (br_if $filterloop (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 1))) (i32.const 2)))
+    end
+    (call $push (f32.mul ;; scaling by the resonance keeps the gain at the formants constant
+        (local.get $out)
+        (call $input (i32.const {{.InputNumber "formant" "resonance"}}))
+    ))
+)
+
+;;-------------------------------------------------------------------------------
+;;   $formant_coef interpolates a coefficient between vowels i and i+1
+;;-------------------------------------------------------------------------------
+(func $formant_coef (param $table i32) (param $pos f32) (result f32)
+    (f32.mul
+        (f32.add
+            (f32.convert_i32_s (i32.load16_s (local.get $table)))
+            (f32.mul
+                (f32.sub
+                    (f32.convert_i32_s (i32.load16_s offset=6 (local.get $table)))
+                    (f32.convert_i32_s (i32.load16_s (local.get $table)))
+                )
+                (local.get $pos)
+            )
+        )
+        (f32.const 0.000030517578125)
+    )
+)
+{{end}}
+
+
+{{- if .HasOp "ladder"}}
+;;-------------------------------------------------------------------------------
+;;   LADDER opcode: four pole lowpass ladder filter with drive
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  filtered(x)
+;;   Stereo: l r ->  filtered(l) filtered(r)
+;;   The filter is solved with zero delay feedback, so the resonance does not
+;;   depend on the frequency. The input of the first stage is soft clipped.
+;;-------------------------------------------------------------------------------
+(func $su_op_ladder (param $stereo i32) (local $a f32) (local $G f32) (local $k f32) (local $u f32) (local $v f32) (local $s f32) (local $i i32)
+{{- if .Stereo "ladder"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "ladder") 2}}))
+{{- end}}
+    (local.set $a (f32.mul
+        (f32.mul
+            (call $input (i32.const {{.InputNumber "ladder" "frequency"}}))
+            (call $input (i32.const {{.InputNumber "ladder" "frequency"}}))
+        )
+        (f32.const 1.5393804) ;; the cutoff goes up to 0.49 times the sample rate
+    ))
+    (local.set $a (f32.div (call $sin (local.get $a)) (call $sin (f32.add (local.get $a) (f32.const 1.5707963))))) ;; g = tan(a)
+    (local.set $G (f32.div (local.get $a) (f32.add (local.get $a) (f32.const 1))))
+    (local.set $k (f32.mul (call $input (i32.const {{.InputNumber "ladder" "resonance"}})) (f32.const 5)))
+    ;; zero delay feedback: solve the input of the first stage from the part of
+    ;; the output that does not depend on it
+    (local.set $u (f32.div
+        (f32.sub
+            (f32.mul
+                (call $pop)
+                (f32.add (f32.mul (call $input (i32.const {{.InputNumber "ladder" "drive"}})) (f32.const 15)) (f32.const 1))
+            )
+            (f32.mul
+                (local.get $k)
+                (f32.mul
+                    (f32.add (f32.mul (f32.add (f32.mul (f32.add (f32.mul
+                        (f32.load (global.get $WRK)) (local.get $G))
+                        (f32.load offset=4 (global.get $WRK))) (local.get $G))
+                        (f32.load offset=8 (global.get $WRK))) (local.get $G))
+                        (f32.load offset=12 (global.get $WRK)))
+                    (f32.sub (f32.const 1) (local.get $G))
+                )
+            )
+        )
+        (f32.add
+            (f32.mul (local.get $k) (f32.mul (local.tee $a (f32.mul (local.get $G) (local.get $G))) (local.get $a)))
+            (f32.const 1)
+        )
+    ))
+    (local.set $u (call $clip (f32.mul (local.get $u) (f32.const 0.6666667)))) ;; soft clip: c*(1.5-c^2/2)
+    (local.set $u (f32.mul (local.get $u) (f32.sub (f32.const 1.5) (f32.mul (f32.mul (local.get $u) (local.get $u)) (f32.const 0.5)))))
+    loop $stageLoop
+        (local.set $s (f32.load (i32.add (global.get $WRK) (local.get $i))))
+        (local.set $v (f32.mul (f32.sub (local.get $u) (local.get $s)) (local.get $G)))
+        (local.set $u (f32.add (local.get $v) (local.get $s)))
+        (f32.store (i32.add (global.get $WRK) (local.get $i)) (f32.add (local.get $u) (local.get $v)))
+        (br_if $stageLoop (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 4))) (i32.const 16)))
+    end
+    (call $push (local.get $u))
+)
+{{end}}
+
+
+{{- if .HasOp "phaser"}}
+;;-------------------------------------------------------------------------------
+;;   PHASER opcode: chain of first order all-pass filters with feedback
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  dry*x+allpass(x)
+;;   Stereo: l r ->  dry*l+allpass(l) dry*r+allpass(r)
+;;   Each stage outputs y=s+a*(u-s), where u is its input and s its state. The
+;;   feedback is solved with zero delay feedback.
+;;-------------------------------------------------------------------------------
+(func $su_op_phaser (param $stereo i32) (local $stages i32) (local $a f32) (local $k f32) (local $ga f32) (local $gb f32) (local $x f32) (local $u f32) (local $d f32) (local $s f32) (local $i i32)
+{{- if .Stereo "phaser"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "phaser") 2}}))
+    (if (local.get $stereo)(then
+        ;; This is hacky: rewind the $VAL one byte backwards as the right channel already
+        ;; scanned it once. Find a way to avoid rewind
+        (global.set $VAL (i32.sub (global.get $VAL) (i32.const 1)))
+    ))
+{{- end}}
+    (local.set $stages (i32.shl (call $scanOperand) (i32.const 2)))
+    (local.set $a (f32.mul
+        (f32.mul
+            (call $input (i32.const {{.InputNumber "phaser" "frequency"}}))
+            (call $input (i32.const {{.InputNumber "phaser" "frequency"}}))
+        )
+        (f32.const 1.5393804) ;; the frequency goes up to 0.49 times the sample rate
+    ))
+    (local.set $a (f32.div (call $sin (local.get $a)) (call $sin (f32.add (local.get $a) (f32.const 1.5707963))))) ;; g = tan(a)
+    (local.set $a (f32.div (f32.sub (local.get $a) (f32.const 1)) (f32.add (local.get $a) (f32.const 1))))
+    (local.set $k (f32.mul (call $inputSigned (i32.const {{.InputNumber "phaser" "feedback"}})) (f32.const 0.99)))
+    ;; the output of the chain is ga*u+(1-a)*gb. Zero delay feedback: solve u=x+k*(ga*u+(1-a)*gb)
+    (local.set $ga (f32.const 1))
+    loop $gainLoop
+        (local.set $ga (f32.mul (local.get $ga) (local.get $a)))
+        (local.set $gb (f32.add (f32.mul (local.get $gb) (local.get $a)) (f32.load (i32.add (global.get $WRK) (local.get $i)))))
+        (br_if $gainLoop (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 4))) (local.get $stages)))
+    end
+    (local.set $u (f32.div
+        (f32.add
+            (local.tee $x (call $pop))
+            (f32.mul (local.get $k) (f32.mul (local.get $gb) (f32.sub (f32.const 1) (local.get $a))))
+        )
+        (f32.sub (f32.const 1) (f32.mul (local.get $k) (local.get $ga)))
+    ))
+    (local.set $i (i32.const 0))
+    loop $stageLoop
+        (local.set $s (f32.load (i32.add (global.get $WRK) (local.get $i))))
+        (local.set $d (f32.sub (local.get $u) (local.get $s)))
+        (local.set $u (f32.add (local.get $s) (f32.mul (local.get $a) (local.get $d))))
+        (f32.store (i32.add (global.get $WRK) (local.get $i)) (f32.add (local.get $u) (local.get $d)))
+        (br_if $stageLoop (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 4))) (local.get $stages)))
+    end
+    (call $push (f32.add
+        (f32.mul (call $input (i32.const {{.InputNumber "phaser" "dry"}})) (local.get $x))
+        (local.get $u)
+    ))
+)
+{{end}}
+
+
 {{- if .HasOp "belleq"}}
 ;;-------------------------------------------------------------------------------
 ;;   BELLEQ opcode: perform second order bell eq filtering on the signal
@@ -275,6 +479,64 @@
 {{end}}
 
 
+{{- if .HasOp "math"}}
+;;-------------------------------------------------------------------------------
+;;   MATH opcode: apply a function on the signal
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  f(x)
+;;   Stereo: l r ->  f(l) f(r)
+;;   where f is abs, sign, tanh, square or sqrt(abs(x)). Only the functions used
+;;   by the song are included.
+;;-------------------------------------------------------------------------------
+(func $su_op_math (param $stereo i32) (local $flags i32) (local $x f32)
+{{- if .Stereo "math"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "math") 2}}))
+    (if (local.get $stereo)(then
+        ;; This is hacky: rewind the $VAL one byte backwards as the right channel already
+        ;; scanned it once. Find a way to avoid rewind
+        (global.set $VAL (i32.sub (global.get $VAL) (i32.const 1)))
+    ))
+{{- end}}
+    (local.set $flags (call $scanOperand))
+    (local.set $x (call $pop))
+{{- if .SupportsParamValue "math" "function" .MathAbs}}
+    (if (i32.and (local.get $flags) (i32.const 0x01)) (then
+        (local.set $x (f32.abs (local.get $x)))
+    ))
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSign}}
+    (if (i32.and (local.get $flags) (i32.const 0x02)) (then
+        (if (f32.ne (local.get $x) (f32.const 0)) (then
+            (local.set $x (f32.copysign (f32.const 1) (local.get $x)))
+        ))
+    ))
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathTanh}}
+    (if (i32.and (local.get $flags) (i32.const 0x04)) (then
+        (local.set $x (f32.sub ;; tanh(x) = 1-2/(e^(2x)+1)
+            (f32.const 1)
+            (f32.div
+                (f32.const 2)
+                (f32.add (call $pow2 (f32.mul (local.get $x) (f32.const 2.8853900817779268))) (f32.const 1))
+            )
+        ))
+    ))
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSquare}}
+    (if (i32.and (local.get $flags) (i32.const 0x08)) (then
+        (local.set $x (f32.mul (local.get $x) (local.get $x)))
+    ))
+{{- end}}
+{{- if .SupportsParamValue "math" "function" .MathSqrt}}
+    (if (i32.and (local.get $flags) (i32.const 0x10)) (then
+        (local.set $x (f32.sqrt (f32.abs (local.get $x))))
+    ))
+{{- end}}
+    (call $push (local.get $x))
+)
+{{end}}
+
+
 {{- if .HasOp "pan" -}}
 ;;-------------------------------------------------------------------------------
 ;;   PAN opcode: pan the signal
@@ -315,6 +577,33 @@
 {{end}}
 
 
+{{- if .HasOp "midside"}}
+;;-------------------------------------------------------------------------------
+;;   MIDSIDE opcode: mid/side encoding, decoding and stereo width
+;;-------------------------------------------------------------------------------
+;;   Encode: l r ->  m w*s, where m=(l+r)/2, s=(l-r)/2 and w is the width
+;;   Decode: m s ->  m+w*s m-w*s
+;;   Width:  encode and decode in one go
+;;-------------------------------------------------------------------------------
+(func $su_op_midside (param $stereo i32) (local $flags i32) (local $x f32) (local $y f32)
+    (local.set $flags (call $scanOperand)) ;; bit 0: encode, bit 1: decode
+    (local.set $x (call $pop))
+    (local.set $y (call $pop))
+    (if (i32.and (local.get $flags) (i32.const 1)) (then
+        (local.set $x (f32.mul (f32.add (local.get $x) (local.get $y)) (f32.const 0.5)))
+        (local.set $y (f32.sub (local.get $x) (local.get $y))) ;; (l+r)/2-r = (l-r)/2
+    ))
+    (local.set $y (f32.mul (local.get $y) (f32.mul (call $input (i32.const {{.InputNumber "midside" "width"}})) (f32.const 2))))
+    (if (i32.and (local.get $flags) (i32.const 2)) (then
+        (local.set $x (f32.add (local.get $x) (local.get $y)))
+        (local.set $y (f32.sub (local.get $x) (f32.add (local.get $y) (local.get $y)))) ;; (m+s)-2s = m-s
+    ))
+    (call $push (local.get $y))
+    (call $push (local.get $x))
+)
+{{end}}
+
+
 {{- if .HasOp "delay"}}
 ;;-------------------------------------------------------------------------------
 ;;   DELAY opcode: adds delay effect to the signal
@@ -327,17 +616,40 @@
 ;;-------------------------------------------------------------------------------
 (func $su_op_delay (param $stereo i32) (local $delayIndex i32) (local $delayCount i32) (local $output f32) (local $s f32) (local $filtstate f32)
 {{- if .Stereo "delay"}} (local $delayCountStash i32) {{- end}}
+{{- if .SupportsParamValue "delay" "pingpong" 1}} (local $pingpong i32) (local $half f32) (local $side f32) (local $feed f32) {{- end}}
 {{- if or (.SupportsModulation "delay" "delaytime") (.SupportsParamValue "delay" "notetracking" 1)}} (local $delayTime f32) {{- end}}
     (local.set $delayIndex (i32.mul (call $scanOperand) (i32.const 2)))
 {{- if .Stereo "delay"}}
     (local.set $delayCountStash (call $scanOperand))
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    (local.set $pingpong (call $scanOperand)) ;; 0 if no ping-pong, otherwise spread+1
+{{- end}}
     (if (local.get $stereo)(then
         (call $su_op_xch (i32.const 0))
     ))
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    (if (local.get $pingpong)(then ;; ping-pong: the mono sum is split between the lines of the channels, the spread moving it towards the left channel
+        (local.set $half (f32.mul (f32.add (call $peek) (call $peek2)) (f32.const 0.25))) ;; half of the mono sum, so the feeds add up to the mono sum
+        (local.set $side (f32.mul
+            (local.get $half)
+            (f32.mul (f32.convert_i32_u (i32.sub (local.get $pingpong) (i32.const 1))) (f32.const 0.0078125))
+        ))
+    ))
+{{- end}}
     loop $stereoLoop
     (local.set $delayCount (local.get $delayCountStash))
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    (local.set $feed (call $peek))
+    (if (local.get $pingpong)(then
+        (local.set $feed (f32.sub (local.get $half) (local.get $side)))
+        (local.set $side (f32.neg (local.get $side))) ;; the left channel gets h+h*s/128
+    ))
+{{- end}}
 {{- else}}
     (local.set $delayCount (call $scanOperand))
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    (drop (call $scanOperand))
+{{- end}}
 {{- end}}
     (local.set $output (f32.mul
         (call $input (i32.const {{.InputNumber "delay" "dry"}}))
@@ -433,7 +745,11 @@
                         (call $input (i32.const {{.InputNumber "delay" "pregain"}}))
                         (call $input (i32.const {{.InputNumber "delay" "pregain"}}))
                     )
+{{- if and (.Stereo "delay") (.SupportsParamValue "delay" "pingpong" 1)}}
+                    (local.get $feed)
+{{- else}}
                     (call $peek)
+{{- end}}
                 )
             )
         )
@@ -467,6 +783,20 @@
     (br_if $stereoLoop (i32.eqz (local.tee $stereo (i32.eqz (local.get $stereo)))))
     end
     (call $su_op_xch (i32.const 0))
+{{- if .SupportsParamValue "delay" "pingpong" 1}}
+    (if (local.get $pingpong)(then ;; cross the feedback by swapping the samples just written to the right and left delay lines
+        (local.set $delayCountStash (i32.shr_u (i32.add (local.get $delayCountStash) (i32.const 1)) (i32.const 1))) ;; number of delay lines per channel
+        (local.set $delayCount (i32.mul (local.get $delayCountStash) (i32.const 262156)))
+        (local.set $delayIndex (i32.add (global.get $delayWRK) (i32.mul (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 4))))
+        loop $swapLoop
+            (local.set $delayIndex (i32.sub (local.get $delayIndex) (i32.const 262156)))
+            (local.set $s (f32.load offset=12 (local.get $delayIndex)))
+            (f32.store offset=12 (local.get $delayIndex) (f32.load offset=12 (i32.sub (local.get $delayIndex) (local.get $delayCount))))
+            (f32.store offset=12 (i32.sub (local.get $delayIndex) (local.get $delayCount)) (local.get $s))
+            (br_if $swapLoop (local.tee $delayCountStash (i32.sub (local.get $delayCountStash) (i32.const 1))))
+        end
+    ))
+{{- end}}
 {{- end}}
 {{- if .SupportsModulation "delay" "delaytime"}}
     (f32.store offset={{.InputNumber "delay" "delaytime" | mul 4 | add 32}} (global.get $WRK) (f32.const 0))
@@ -475,6 +805,509 @@
 {{end}}
 
 
+{{- if .HasOp "pluck"}}
+;;-------------------------------------------------------------------------------
+;;   PLUCK opcode: Karplus-Strong comb filter, tuned to the note
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  x+g*damp(b[t-L]), where L is the period of the note
+;;   Stereo: l r ->  the same for both channels, with opposite detunes
+;;-------------------------------------------------------------------------------
+(func $su_op_pluck (param $stereo i32) (local $detune f32) (local $damp f32) (local $length f32) (local $n i32) (local $s f32) (local $filtstate f32) (local $c f32)
+    (local.set $detune (call $inputSigned (i32.const {{.InputNumber "pluck" "detune"}})))
+    (local.set $damp (f32.mul (call $input (i32.const {{.InputNumber "pluck" "damp"}})) (f32.const 0.99609375)))
+{{- if .Stereo "pluck"}}
+    (if (local.get $stereo)(then
+        (call $su_op_xch (i32.const 0))
+    ))
+    loop $stereoLoop
+{{- end}}
+    (local.set $length (f32.max
+        (f32.sub
+            (f32.div
+                (f32.const 1)
+                (f32.mul
+                    (call $pow2 (f32.mul
+                        (f32.add
+                            (f32.add
+                                (f32.div
+                                    (call $inputSigned (i32.const {{.InputNumber "pluck" "transpose"}}))
+                                    (f32.const 0.015625)
+                                )
+                                (local.get $detune)
+                            )
+                            (f32.convert_i32_u (i32.load (global.get $voice)))
+                        )
+                        (f32.const 0.083333333)
+                    ))
+                    (f32.const 0.000092696138)
+                )
+            ) ;; the period of the note in samples
+            (f32.div (local.get $damp) (f32.sub (f32.const 1) (local.get $damp))) ;; the delay of the damping filter
+        )
+        (f32.const 1)
+    ))
+    (local.set $n (i32.trunc_f32_u (local.get $length)))
+    (local.set $length (f32.sub (local.get $length) (f32.convert_i32_u (local.get $n)))) ;; fractional part of the period
+    (local.set $s (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n)&65535)*4
+        (i32.shl (i32.and (i32.sub (global.get $globaltick) (local.get $n)) (i32.const 65535)) (i32.const 2))
+        (global.get $delayWRK)
+    )))
+    (local.set $s (f32.add
+        (local.get $s)
+        (f32.mul
+            (f32.sub
+                (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n-1)&65535)*4
+                    (i32.shl (i32.and (i32.sub (global.get $globaltick) (i32.add (local.get $n) (i32.const 1))) (i32.const 65535)) (i32.const 2))
+                    (global.get $delayWRK)
+                ))
+                (local.get $s)
+            )
+            (local.get $length)
+        )
+    ))
+    (f32.store
+        (global.get $delayWRK)
+        (local.tee $filtstate
+            (f32.add
+                (f32.mul
+                    (f32.sub
+                        (f32.load (global.get $delayWRK))
+                        (local.get $s)
+                    )
+                    (local.get $damp)
+                )
+                (local.get $s)
+            )
+        )
+    )
+    (local.set $c (f32.sub (f32.const 1) (call $input (i32.const {{.InputNumber "pluck" "decay"}}))))
+    (local.set $c (f32.mul (local.get $c) (local.get $c)))
+    (call $push (f32.add
+        (call $pop)
+        (f32.mul
+            (f32.sub (f32.const 1) (f32.mul (local.get $c) (local.get $c))) ;; feedback g=1-(1-decay)^4
+            (local.get $filtstate)
+        )
+    ))
+    (f32.store offset=12
+        (i32.add ;; delayWRK + (globalTick&65535)*4
+            (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )
+        (call $peek)
+    )
+    (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const 262156)))
+{{- if .Stereo "pluck"}}
+    (call $su_op_xch (i32.const 0))
+    (local.set $detune (f32.neg (local.get $detune)))
+    (br_if $stereoLoop (i32.eqz (local.tee $stereo (i32.eqz (local.get $stereo)))))
+    end
+    (call $su_op_xch (i32.const 0))
+{{- end}}
+)
+{{end}}
+
+
+{{- if .HasOp "chorus"}}
+;;-------------------------------------------------------------------------------
+;;   CHORUS opcode: delay line read at a position modulated by a sine LFO
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  x+w*b[t-L], where L=1+1024*d+512*e*(1+sin(2*pi*p))
+;;   Stereo: l r ->  the same for both channels, the LFO of r ahead by the spread
+;;-------------------------------------------------------------------------------
+(func $su_op_chorus (param $stereo i32) (local $phase f32) (local $length f32) (local $n i32) (local $s f32)
+    (f32.store
+        (global.get $WRK)
+        (local.tee $phase
+            (f32.sub
+                (local.tee $phase (f32.add
+                    (f32.load (global.get $WRK))
+                    (f32.mul
+                        (f32.mul
+                            (call $input (i32.const {{.InputNumber "chorus" "rate"}}))
+                            (call $input (i32.const {{.InputNumber "chorus" "rate"}}))
+                        )
+                        (f32.const 0.00022675737) ;; the max rate is 10 Hz
+                    )
+                ))
+                (f32.floor (local.get $phase))
+            )
+        )
+    )
+{{- if .Stereo "chorus"}}
+    (if (local.get $stereo)(then
+        (call $su_op_xch (i32.const 0))
+    ))
+    loop $stereoLoop
+{{- end}}
+    (local.set $length (f32.add
+        (f32.add
+            (f32.const 1)
+            (f32.mul (call $input (i32.const {{.InputNumber "chorus" "delay"}})) (f32.const 1024))
+        )
+        (f32.mul
+            (f32.mul (call $input (i32.const {{.InputNumber "chorus" "depth"}})) (f32.const 512))
+            (f32.add
+                (f32.const 1)
+                (call $sin (f32.mul
+{{- if .Stereo "chorus"}}
+                    (f32.add ;; the LFO of the right channel is ahead by the spread
+                        (local.get $phase)
+                        (select
+                            (f32.mul (call $input (i32.const {{.InputNumber "chorus" "spread"}})) (f32.const 0.5))
+                            (f32.const 0)
+                            (local.get $stereo)
+                        )
+                    )
+{{- else}}
+                    (local.get $phase)
+{{- end}}
+                    (f32.const 6.28318530718)
+                ))
+            )
+        )
+    ))
+    (local.set $n (i32.trunc_f32_u (local.get $length)))
+    (local.set $length (f32.sub (local.get $length) (f32.convert_i32_u (local.get $n)))) ;; fractional part of the delay
+    (local.set $s (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n)&65535)*4
+        (i32.shl (i32.and (i32.sub (global.get $globaltick) (local.get $n)) (i32.const 65535)) (i32.const 2))
+        (global.get $delayWRK)
+    )))
+    (local.set $s (f32.add
+        (local.get $s)
+        (f32.mul
+            (f32.sub
+                (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n-1)&65535)*4
+                    (i32.shl (i32.and (i32.sub (global.get $globaltick) (i32.add (local.get $n) (i32.const 1))) (i32.const 65535)) (i32.const 2))
+                    (global.get $delayWRK)
+                ))
+                (local.get $s)
+            )
+            (local.get $length)
+        )
+    ))
+    (f32.store offset=12
+        (i32.add ;; delayWRK + (globalTick&65535)*4
+            (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )
+        (f32.add
+            (call $peek)
+            (f32.mul
+                (f32.mul (call $inputSigned (i32.const {{.InputNumber "chorus" "feedback"}})) (f32.const 0.99))
+                (local.get $s)
+            )
+        )
+    )
+    (call $push (f32.add
+        (call $pop)
+        (f32.mul (call $input (i32.const {{.InputNumber "chorus" "wet"}})) (local.get $s))
+    ))
+    (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const 262156)))
+{{- if .Stereo "chorus"}}
+    (call $su_op_xch (i32.const 0))
+    (br_if $stereoLoop (i32.eqz (local.tee $stereo (i32.eqz (local.get $stereo)))))
+    end
+    (call $su_op_xch (i32.const 0))
+{{- end}}
+)
+{{end}}
+
+
+{{- if .HasOp "reverb"}}
+;;-------------------------------------------------------------------------------
+;;   REVERB opcode: feedback delay network reverb
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  dr*x+w*(o0-o3)
+;;   Stereo: l r ->  dr*l+w*(o0-o3) dr*r+w*(o1-o2)
+;;
+;;   where o0-o3 are the damped outputs of the four lines of the network. The
+;;   lines are mixed with a Hadamard matrix and fed back, adding the predelayed
+;;   mono sum of the input. The line lengths are modulated by a sine LFO.
+;;-------------------------------------------------------------------------------
+(func $su_op_reverb (param $stereo i32) (local $delayIndex i32) (local $phase f32) (local $length f32) (local $n i32) (local $s f32)
+    (local $i i32) (local $predelayed f32) (local $h f32) (local $a f32) (local $b f32) (local $c f32) (local $e f32)
+    (local.set $delayIndex (i32.mul (call $scanOperand) (i32.const 2)))
+    (f32.store
+        (global.get $WRK)
+        (local.tee $phase
+            (f32.sub
+                (local.tee $phase (f32.add
+                    (f32.load (global.get $WRK))
+                    (f32.const 0.000011337868) ;; the LFO runs at 0.5 Hz
+                ))
+                (f32.floor (local.get $phase))
+            )
+        )
+    )
+    (f32.store offset={{add 12 (mul 4 262156)}} ;; the fifth line is the predelay
+        (i32.add ;; delayWRK + (globalTick&65535)*4
+            (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )
+{{- if .Stereo "reverb"}}
+        (select
+            (f32.mul (f32.add (call $peek) (call $peek2)) (f32.const 0.5))
+            (call $peek)
+            (local.get $stereo)
+        )
+{{- else}}
+        (call $peek)
+{{- end}}
+    )
+    (local.set $predelayed (f32.load offset={{add 12 (mul 4 262156)}}
+        (i32.add ;; delayWRK + ((globalTick-delaytimes[delayIndex+4])&65535)*4
+            (i32.shl
+                (i32.and
+                    (i32.sub
+                        (global.get $globaltick)
+                        (i32.load16_u offset={{add (index .Labels "su_delay_times") 8}} (local.get $delayIndex))
+                    )
+                    (i32.const 65535)
+                )
+                (i32.const 2)
+            )
+            (global.get $delayWRK)
+        )
+    ))
+    loop $lineLoop
+        (local.set $length (f32.add
+            (f32.convert_i32_u (i32.load16_u offset={{index .Labels "su_delay_times"}} (local.get $delayIndex)))
+            (f32.mul
+                (f32.mul (call $input (i32.const {{.InputNumber "reverb" "modulation"}})) (f32.const 16))
+                (call $sin (f32.mul
+                    (f32.add (local.get $phase) (f32.mul (f32.convert_i32_u (local.get $i)) (f32.const 0.25))) ;; each line is a quarter cycle ahead in the LFO
+                    (f32.const 6.28318530718)
+                ))
+            )
+        ))
+        (local.set $n (i32.trunc_f32_u (local.get $length)))
+        (local.set $length (f32.sub (local.get $length) (f32.convert_i32_u (local.get $n)))) ;; fractional part of the length
+        (local.set $s (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n)&65535)*4
+            (i32.shl (i32.and (i32.sub (global.get $globaltick) (local.get $n)) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )))
+        (local.set $s (f32.add
+            (local.get $s)
+            (f32.mul
+                (f32.sub
+                    (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-n-1)&65535)*4
+                        (i32.shl (i32.and (i32.sub (global.get $globaltick) (i32.add (local.get $n) (i32.const 1))) (i32.const 65535)) (i32.const 2))
+                        (global.get $delayWRK)
+                    ))
+                    (local.get $s)
+                )
+                (local.get $length)
+            )
+        ))
+        (f32.store
+            (global.get $delayWRK)
+            (f32.add
+                (f32.mul
+                    (f32.sub
+                        (f32.load (global.get $delayWRK))
+                        (local.get $s)
+                    )
+                    (call $input (i32.const {{.InputNumber "reverb" "damping"}}))
+                )
+                (local.get $s)
+            )
+        )
+        (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const 262156)))
+        (local.set $delayIndex (i32.add (local.get $delayIndex) (i32.const 2)))
+        (br_if $lineLoop (i32.lt_u (local.tee $i (i32.add (local.get $i) (i32.const 1))) (i32.const 4)))
+    end
+    (global.set $delayWRK (i32.sub (global.get $delayWRK) (i32.const {{mul 4 262156}}))) ;; back to the first line
+    ;; mix the lines with a 4x4 Hadamard matrix, scaled by 1/2 to keep it orthogonal
+    (local.set $h (f32.mul
+        (f32.sub
+            (f32.const 1)
+            (f32.mul
+                (local.tee $s (f32.sub (f32.const 1) (call $input (i32.const {{.InputNumber "reverb" "decay"}}))))
+                (local.get $s)
+            )
+        )
+        (f32.const 0.5)
+    ))
+    (local.set $a (f32.add (f32.load (global.get $delayWRK)) (f32.load offset=262156 (global.get $delayWRK))))
+    (local.set $b (f32.sub (f32.load (global.get $delayWRK)) (f32.load offset=262156 (global.get $delayWRK))))
+    (local.set $c (f32.add (f32.load offset={{mul 2 262156}} (global.get $delayWRK)) (f32.load offset={{mul 3 262156}} (global.get $delayWRK))))
+    (local.set $e (f32.sub (f32.load offset={{mul 2 262156}} (global.get $delayWRK)) (f32.load offset={{mul 3 262156}} (global.get $delayWRK))))
+    (local.set $n (i32.add ;; delayWRK + (globalTick&65535)*4
+        (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+        (global.get $delayWRK)
+    ))
+    (f32.store offset=12 (local.get $n) (f32.add (f32.mul (f32.add (local.get $a) (local.get $c)) (local.get $h)) (local.get $predelayed)))
+    (f32.store offset={{add 12 262156}} (local.get $n) (f32.add (f32.mul (f32.add (local.get $b) (local.get $e)) (local.get $h)) (local.get $predelayed)))
+    (f32.store offset={{add 12 (mul 2 262156)}} (local.get $n) (f32.add (f32.mul (f32.sub (local.get $a) (local.get $c)) (local.get $h)) (local.get $predelayed)))
+    (f32.store offset={{add 12 (mul 3 262156)}} (local.get $n) (f32.add (f32.mul (f32.sub (local.get $b) (local.get $e)) (local.get $h)) (local.get $predelayed)))
+    (local.set $s (call $pop))
+{{- if .Stereo "reverb"}}
+    (if (local.get $stereo)(then
+        (call $push (f32.add
+            (f32.mul (call $pop) (call $input (i32.const {{.InputNumber "reverb" "dry"}})))
+            (f32.mul
+                (f32.sub (f32.load offset=262156 (global.get $delayWRK)) (f32.load offset={{mul 2 262156}} (global.get $delayWRK)))
+                (call $input (i32.const {{.InputNumber "reverb" "wet"}}))
+            )
+        ))
+    ))
+{{- end}}
+    (call $push (f32.add
+        (f32.mul (local.get $s) (call $input (i32.const {{.InputNumber "reverb" "dry"}})))
+        (f32.mul
+            (f32.sub (f32.load (global.get $delayWRK)) (f32.load offset={{mul 3 262156}} (global.get $delayWRK)))
+            (call $input (i32.const {{.InputNumber "reverb" "wet"}}))
+        )
+    ))
+    (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const {{mul 5 262156}})))
+)
+{{end}}
+
+
+{{- if .HasOp "follower"}}
+;;-------------------------------------------------------------------------------
+;;   FOLLOWER opcode: envelope follower
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  l, where l is the smoothed absolute value of x
+;;   Stereo: l r ->  the same for both channels
+;;-------------------------------------------------------------------------------
+(func $su_op_follower (param $stereo i32) (local $x f32) (local $level f32)
+{{- if .Stereo "follower"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "follower") 2}}))
+{{- end}}
+    (local.set $x (f32.abs (call $pop)))
+    (local.set $level (f32.load (global.get $WRK)))
+    (f32.store (global.get $WRK) (local.tee $level (f32.add ;; l'=l + c*(|x|-l)
+        (f32.mul
+            (call $nonLinearMap (f32.lt (local.get $x) (local.get $level))) ;; c is either attack or release
+            (f32.sub (local.get $x) (local.get $level))
+        )
+        (local.get $level)
+    )))
+    (call $push (local.get $level))
+)
+{{end}}
+
+
+{{- if .HasOp "slew"}}
+;;-------------------------------------------------------------------------------
+;;   SLEW opcode: slew limiter
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  y+max(min(x-y,r),-f), where y is the previous output
+;;   Stereo: l r ->  the same for both channels
+;;-------------------------------------------------------------------------------
+(func $su_op_slew (param $stereo i32) (local $y f32)
+{{- if .Stereo "slew"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "slew") 2}}))
+{{- end}}
+    (local.set $y (f32.load (global.get $WRK)))
+    (f32.store (global.get $WRK) (local.tee $y (f32.add
+        (f32.max
+            (f32.min
+                (f32.sub (call $pop) (local.get $y))
+                (call $nonLinearMap (i32.const {{.InputNumber "slew" "rise"}}))
+            )
+            (f32.neg (call $nonLinearMap (i32.const {{.InputNumber "slew" "fall"}})))
+        )
+        (local.get $y)
+    )))
+    (call $push (local.get $y))
+)
+{{end}}
+
+
+{{- if .HasOp "limiter"}}
+;;-------------------------------------------------------------------------------
+;;   LIMITER opcode: brickwall limiter with lookahead
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  g*x[t-L]
+;;   Stereo: l r ->  g*l[t-L] g*r[t-L], where g is common for both channels
+;;   The gain reduction needed by each sample is faded in linearly during the
+;;   lookahead, so the output does not exceed the ceiling.
+;;-------------------------------------------------------------------------------
+(func $su_op_limiter (param $stereo i32) (local $length i32) (local $k i32) (local $reduction f32) (local $ptr i32) (local $x f32)
+    (local.set $length (i32.add (i32.shl (call $scanOperand) (i32.const 1)) (i32.const 1)))
+    (f32.store offset=12
+        (i32.add ;; delayWRK + (globalTick&65535)*4
+            (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )
+        (f32.sub
+            (f32.const 1)
+            (f32.div
+                (call $input (i32.const {{.InputNumber "limiter" "ceiling"}}))
+                (f32.max
+                    (call $input (i32.const {{.InputNumber "limiter" "ceiling"}}))
+{{- if .Stereo "limiter"}}
+                    (f32.max
+                        (f32.abs (call $peek))
+                        (select (f32.abs (call $peek2)) (f32.const 0) (local.get $stereo))
+                    )
+{{- else}}
+                    (f32.abs (call $peek))
+{{- end}}
+                )
+            )
+        ) ;; the gain reduction needed by the incoming sample
+    )
+    (local.set $k (local.get $length))
+    loop $scanLoop ;; the gain reduction needed k samples ago is faded in linearly
+        (local.set $reduction (f32.max
+            (local.get $reduction)
+            (f32.mul
+                (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-k)&65535)*4
+                    (i32.shl (i32.and (i32.sub (global.get $globaltick) (local.get $k)) (i32.const 65535)) (i32.const 2))
+                    (global.get $delayWRK)
+                ))
+                (f32.convert_i32_u (local.get $k))
+            )
+        ))
+        (br_if $scanLoop (local.tee $k (i32.sub (local.get $k) (i32.const 1))))
+    end
+    (f32.store
+        (global.get $WRK)
+        (local.tee $reduction (f32.max
+            (f32.mul
+                (f32.load (global.get $WRK))
+                (f32.sub (f32.const 1) (call $nonLinearMap (i32.const {{.InputNumber "limiter" "release"}})))
+            )
+            (f32.div (local.get $reduction) (f32.convert_i32_u (local.get $length)))
+        ))
+    )
+    (local.set $ptr (global.get $sp))
+{{- if .Stereo "limiter"}}
+    loop $stereoLoop
+{{- end}}
+    (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const 262156)))
+    (local.set $x (f32.load (local.get $ptr)))
+    (f32.store
+        (local.get $ptr)
+        (f32.mul
+            (f32.load offset=12 (i32.add ;; delayWRK + ((globalTick-L)&65535)*4
+                (i32.shl (i32.and (i32.sub (global.get $globaltick) (local.get $length)) (i32.const 65535)) (i32.const 2))
+                (global.get $delayWRK)
+            ))
+            (f32.sub (f32.const 1) (local.get $reduction))
+        )
+    )
+    (f32.store offset=12
+        (i32.add ;; delayWRK + (globalTick&65535)*4
+            (i32.shl (i32.and (global.get $globaltick) (i32.const 65535)) (i32.const 2))
+            (global.get $delayWRK)
+        )
+        (local.get $x)
+    )
+{{- if .Stereo "limiter"}}
+    (local.set $ptr (i32.add (local.get $ptr) (i32.const 4)))
+    (br_if $stereoLoop (i32.eqz (local.tee $stereo (i32.eqz (local.get $stereo)))))
+    end
+{{- end}}
+    (global.set $delayWRK (i32.add (global.get $delayWRK) (i32.const 262156)))
+)
+{{end}}
+
+
 {{- if .HasOp "compressor"}}
 ;;-------------------------------------------------------------------------------
 ;;   COMPRES opcode: push compressor gain to stack
@@ -483,8 +1316,14 @@
 ;;           you can either MULP to compress the signal or SEND it to a GAIN
 ;;           somewhere else for compressor side-chaining.
 ;;   Stereo: push g g on stack, where g is calculated using l^2 + r^2
+;;   Sidechain: the signal (k or kl kr) is a key driving the gain reduction and
+;;           it is replaced by g (or g g), so MULP compresses the signal below
+;;           the key.
 ;;-------------------------------------------------------------------------------
-(func $su_op_compressor (param $stereo i32) (local $x2 f32) (local $level f32) (local $t2 f32)
+(func $su_op_compressor (param $stereo i32) (local $x2 f32) (local $level f32) (local $t2 f32){{if .SupportsParamValue "compressor" "sidechain" 1}} (local $sidechain i32){{end}}
+{{- if .SupportsParamValue "compressor" "sidechain" 1}}
+    (local.set $sidechain (call $scanOperand))
+{{- end}}
 {{- if .Stereo "compressor"}}
     (local.set $x2 (f32.mul
         (call $peek)
@@ -544,6 +1383,18 @@
         (call $pop)
         (call $input (i32.const {{.InputNumber "compressor" "invgain"}}))
     ))
+{{- if .SupportsParamValue "compressor" "sidechain" 1}}
+    (if (local.get $sidechain)(then ;; the key is replaced by the gain
+        (local.set $t2 (call $pop))
+        (drop (call $pop))
+{{- if .Stereo "compressor"}}
+        (if (local.get $stereo)(then
+            (drop (call $pop))
+        ))
+{{- end}}
+        (call $push (local.get $t2))
+    ))
+{{- end}}
 {{- if .Stereo "compressor"}}
     (if (local.get $stereo)(then
         (call $push (call $peek))
@@ -25,6 +25,12 @@
         {{- $.DataB .}}
     {{- end}}
 {{- end}}
+{{- /* the transposes of the patterns, if any, are stored right after the sequences */}}
+{{- range .Transposes}}
+    {{- range .}}
+        {{- $.DataB .}}
+    {{- end}}
+{{- end}}
 
 {{- /*
 ;------------------------------------------------------------------------------
@@ -56,6 +62,44 @@
 {{- $.DataW .}}
 {{- end}}
 
+{{- /*
+;-------------------------------------------------------------------------------
+;    Automation lanes: the operands they set and the values in the patch
+;-------------------------------------------------------------------------------
+*/}}
+{{- if .Lanes}}
+{{- .SetDataLabel "su_lane_operands"}}
+{{- range .Lanes}}
+{{- $.DataW .Operand}}
+{{- end}}
+{{- .SetDataLabel "su_lane_values"}}
+{{- range .Lanes}}
+{{- $.DataB .Value}}
+{{- end}}
+{{- end}}
+
+{{- /*
+;-------------------------------------------------------------------------------
+;    Wavetables
+;-------------------------------------------------------------------------------
+*/}}
+{{- .SetDataLabel "su_wavetables"}}
+{{- range .Wavetables}}
+{{- $.DataW .}}
+{{- end}}
+
+{{- /*
+;-------------------------------------------------------------------------------
+;    The filter coefficients of the vowels, used by the formant opcode
+;-------------------------------------------------------------------------------
+*/}}
+{{- if .HasOp "formant"}}
+{{- .SetDataLabel "su_formant_table"}}
+{{- range .FormantTable}}
+{{- $.DataW .}}
+{{- end}}
+{{- end}}
+
 {{- /*
 ;-------------------------------------------------------------------------------
 ; The number of transformed parameters each opcode takes
@@ -145,7 +189,7 @@
 (global $COM_instr_start (mut i32) (i32.const 0))
 (global $VAL_instr_start (mut i32) (i32.const 0))
 {{- end}}
-{{- if .HasOp "delay"}}
+{{- if or (.HasOp "delay") (.HasOp "pluck") (.HasOp "chorus") (.HasOp "limiter") (.HasOp "reverb")}}
 (global $delayWRK (mut i32) (i32.const 0))
 {{- end}}
 (global $globaltick (mut i32) (i32.const 0))
@@ -209,6 +253,9 @@
         (global.set $row (i32.const 0))
         loop $row_loop
             (call $su_update_voices)
+{{- if .Lanes}}
+            (call $su_update_lanes)
+{{- end}}
             (global.set $sample (i32.const 0))
             loop $sample_loop
                 (global.set $COM (i32.const {{index .Labels "su_patch_opcodes"}}))
@@ -220,7 +267,7 @@
                 (global.set $WRK (i32.const {{index .Labels "su_voices"}}))
                 (global.set $voice (i32.const {{index .Labels "su_voices"}}))
                 (global.set $voicesRemain (i32.const {{.Song.Patch.NumVoices | printf "%v"}}))
-{{- if .HasOp "delay"}}
+{{- if or (.HasOp "delay") (.HasOp "pluck") (.HasOp "chorus") (.HasOp "limiter") (.HasOp "reverb")}}
                 (global.set $delayWRK (i32.const {{index .Labels "su_delaylines"}}))
 {{- end}}
                 (call $su_run_vm)
@@ -240,7 +287,7 @@
 {{- if ne .VoiceTrackBitmask 0}}
 ;; the complex implementation of update_voices: at least one track has more than one voice
 (func $su_update_voices (local $si i32) (local $di i32) (local $tracksRemaining i32) (local $note i32) (local $firstVoice i32) (local $nextTrackStartsAt i32) (local $numVoices i32) (local $voiceNo i32)
-    (local.set $tracksRemaining (i32.const {{len .Sequences}}))
+    (local.set $tracksRemaining (i32.const {{len .Song.Score.Tracks}}))
     (local.set $si (global.get $pattern))
     (local.set $nextTrackStartsAt (i32.const 0))
     loop $track_loop
@@ -262,7 +309,21 @@
         (i32.mul (i32.const {{.PatternLength}}))
         (i32.add (global.get $row))
         (i32.load8_u offset={{index .Labels "su_patterns"}})
+        {{- if .Transposes}}
+        (local.set $note)
+        (if (i32.gt_u (local.get $note) (i32.const {{.Hold}}))(then ;; only notes are transposed, not holds or releases
+            (local.set $note (i32.and
+                (i32.add
+                    (local.get $note)
+                    (i32.load8_u offset={{add (index .Labels "su_tracks") (mul (len .Sequences) .SequenceLength)}} (local.get $si))
+                )
+                (i32.const 255)
+            ))
+        ))
+        (local.get $note)
+        {{- else}}
         (local.tee $note)
+        {{- end}}
         (if (i32.ne (i32.const {{.Hold}}))(then
             (i32.store offset={{add (index .Labels "su_voices") 4}}
                 (i32.mul
@@ -302,7 +363,7 @@
 {{- else}}
 ;; the simple implementation of update_voices: each track has exactly one voice
 (func $su_update_voices (local $si i32) (local $di i32) (local $tracksRemaining i32) (local $note i32)
-    (local.set $tracksRemaining (i32.const {{len .Sequences}}))
+    (local.set $tracksRemaining (i32.const {{len .Song.Score.Tracks}}))
     (local.set $si (global.get $pattern))
     (local.set $di (i32.const {{index .Labels "su_voices"}}))
     loop $track_loop
@@ -310,7 +371,21 @@
         (i32.mul (i32.const {{.PatternLength}}))
         (i32.add (global.get $row))
         (i32.load8_u offset={{index .Labels "su_patterns"}})
+        {{- if .Transposes}}
+        (local.set $note)
+        (if (i32.gt_u (local.get $note) (i32.const {{.Hold}}))(then ;; only notes are transposed, not holds or releases
+            (local.set $note (i32.and
+                (i32.add
+                    (local.get $note)
+                    (i32.load8_u offset={{add (index .Labels "su_tracks") (mul (len .Sequences) .SequenceLength)}} (local.get $si))
+                )
+                (i32.const 255)
+            ))
+        ))
+        (local.get $note)
+        {{- else}}
         (local.tee $note)
+        {{- end}}
         (if (i32.ne (i32.const {{.Hold}}))(then
             (i32.store offset=4 (local.get $di) (i32.const 0)) ;; release the note
             (if (i32.gt_u (local.get $note) (i32.const {{.Hold}}))(then
@@ -326,6 +401,44 @@
 )
 {{- end}}
 
+{{- if .Lanes}}
+
+;; the automation lanes write their values directly to the operands of the units
+(func $su_update_lanes (local $si i32) (local $lane i32) (local $value i32)
+    (local.set $si (i32.add (global.get $pattern) (i32.const {{mul (len .Song.Score.Tracks) .SequenceLength}}))) ;; the lanes are after the tracks
+    loop $lane_loop
+        (i32.load8_u offset={{index .Labels "su_tracks"}} (local.get $si))
+        (i32.mul (i32.const {{.PatternLength}}))
+        (i32.add (global.get $row))
+        (i32.load8_u offset={{index .Labels "su_patterns"}})
+        (local.set $value)
+        {{- if .Transposes}}
+        (if (i32.gt_u (local.get $value) (i32.const {{.Hold}}))(then ;; only values are transposed, not holds or releases
+            (local.set $value (i32.and
+                (i32.add
+                    (local.get $value)
+                    (i32.load8_u offset={{add (index .Labels "su_tracks") (mul (len .Sequences) .SequenceLength)}} (local.get $si))
+                )
+                (i32.const 255)
+            ))
+        ))
+        {{- end}}
+        (if (i32.ne (local.get $value) (i32.const {{.Hold}}))(then ;; hold keeps the current value
+            (i32.store8 offset={{index .Labels "su_patch_operands"}}
+                (i32.load16_u offset={{index .Labels "su_lane_operands"}} (i32.shl (local.get $lane) (i32.const 1)))
+                (select
+                    (local.get $value)
+                    (i32.load8_u offset={{index .Labels "su_lane_values"}} (local.get $lane)) ;; release restores the value in the patch
+                    (local.get $value)
+                )
+            )
+        ))
+        (local.set $si (i32.add (local.get $si) (i32.const {{.SequenceLength}})))
+        (br_if $lane_loop (i32.lt_u (local.tee $lane (i32.add (local.get $lane) (i32.const 1))) (i32.const {{len .Lanes}})))
+    end
+)
+{{- end}}
+
 {{template "patch.wat" .}}
 
 
@@ -23,35 +23,93 @@
 
 
 {{if .HasOp "envelope" -}}
+{{- $curves := or (.SupportsParamValueOtherThan "envelope" "attackcurve" 0) (.SupportsParamValueOtherThan "envelope" "decaycurve" 0) (.SupportsParamValueOtherThan "envelope" "releasecurve" 0)}}
 ;;-------------------------------------------------------------------------------
 ;;   ENVELOPE opcode: pushes an ADSR envelope value on stack [0,1]
 ;;-------------------------------------------------------------------------------
 ;;   Mono:   push the envelope value on stack
 ;;   Stereo: push the envelope valeu on stack twice
+;;   Curves: the step of a segment is multiplied by 1+c*(2*d-1), where d is the
+;;           remaining distance to the end of the segment divided by the span of
+;;           the segment (1, 1-sustain or the level where the release started)
 ;;-------------------------------------------------------------------------------
-(func $su_op_envelope (param $stereo i32) (local $state i32) (local $level f32) (local $delta f32)
+{{- if $curves}}
+(func $envelopeCurve (param $curve f32) (param $distance f32) (param $span f32) (result f32)
+    (local.set $distance (f32.div ;; the distance relative to the span; the small constant avoids dividing by zero
+        (local.get $distance)
+        (f32.add (local.get $span) (f32.const 0.00000095367431640625))
+    ))
+    (f32.add
+        (f32.const 1)
+        (f32.mul
+            (local.get $curve)
+            (f32.sub (f32.add (local.get $distance) (local.get $distance)) (f32.const 1))
+        )
+    )
+)
+{{- end}}
+(func $su_op_envelope (param $stereo i32) (local $state i32) (local $level f32) (local $delta f32){{if $curves}} (local $curve f32){{end}}
     (if (i32.eqz (i32.load offset=4 (global.get $voice))) (then ;; if voice.sustain == 0
+{{- if $curves}}
+        (if (i32.ne (i32.load (global.get $WRK)) (i32.const {{.InputNumber "envelope" "release"}})) (then
+            (f32.store offset=8 (global.get $WRK) (f32.load offset=4 (global.get $WRK))) ;; the level where the release started
+        ))
+{{- end}}
         (i32.store (global.get $WRK) (i32.const {{.InputNumber "envelope" "release"}})) ;; set envelope state to release
     ))
     (local.set $state (i32.load (global.get $WRK)))
     (local.set $level (f32.load offset=4 (global.get $WRK)))
     (local.set $delta (call $nonLinearMap (local.get $state)))
+{{- if $curves}}
+    (local.set $curve (f32.mul ;; c=curve*15/1024, the curve operands being attack, decay and release curve+64
+        (f32.convert_i32_s (i32.sub
+            (i32.load8_u (i32.add
+                (global.get $VAL)
+                (i32.shr_u (i32.add (local.get $state) (i32.const 1)) (i32.const 1))
+            ))
+            (i32.const 64)
+        ))
+        (f32.const 0.0146484375)
+    ))
+    (global.set $VAL (i32.add (global.get $VAL) (i32.const 3)))
+{{- end}}
     (if (local.get $state) (then
         (if (i32.eq (local.get $state) (i32.const 1))(then ;; state is 1 aka decay
+{{- if $curves}}
+            (local.set $level (f32.sub (local.get $level) (f32.mul
+                (local.get $delta)
+                (call $envelopeCurve (local.get $curve) (f32.sub (local.get $level) (call $input (i32.const 2))) (f32.sub (f32.const 1) (call $input (i32.const 2))))
+            )))
+{{- else}}
             (local.set $level (f32.sub (local.get $level) (local.get $delta)))
+{{- end}}
             (if (f32.le (local.get $level) (call $input (i32.const 2)))(then
                 (local.set $level (call $input (i32.const 2)))
                 (local.set $state (i32.const {{.InputNumber "envelope" "sustain"}}))
             ))
         ))
         (if (i32.eq (local.get $state) (i32.const {{.InputNumber "envelope" "release"}}))(then ;; state is 3 aka release
+{{- if $curves}}
+            (local.set $level (f32.sub (local.get $level) (f32.mul
+                (local.get $delta)
+                (call $envelopeCurve (local.get $curve) (local.get $level) (f32.load offset=8 (global.get $WRK)))
+            )))
+{{- else}}
             (local.set $level (f32.sub (local.get $level) (local.get $delta)))
+{{- end}}
             (if (f32.le (local.get $level) (f32.const 0)) (then
                 (local.set $level (f32.const 0))
             ))
         ))
     )(else ;; the state is 0 aka attack
+{{- if $curves}}
+        (local.set $level (f32.add (local.get $level) (f32.mul
+            (local.get $delta)
+            (call $envelopeCurve (local.get $curve) (f32.sub (f32.const 1) (local.get $level)) (f32.const 1))
+        )))
+{{- else}}
         (local.set $level (f32.add (local.get $level) (local.get $delta)))
+{{- end}}
         (if (f32.ge (local.get $level) (f32.const 1))(then
             (local.set $level (f32.const 1))
             (local.set $state (i32.const 1))
@@ -96,6 +154,85 @@
 {{end}}
 
 
+{{- if .HasOp "ramp"}}
+;;-------------------------------------------------------------------------------
+;;   RAMP opcode: the position of the song within a tempo-synced period
+;;-------------------------------------------------------------------------------
+;;   Mono:   push the ramp value [0,1] on stack
+;;   Stereo: push the ramp value twice on stack
+;;-------------------------------------------------------------------------------
+(func $su_op_ramp (param $stereo i32) (local $x f64) (local $val f32)
+    (local.set $x (f64.add ;; x=t*i+p, where i is the number of periods per sample
+        (f64.mul
+            (f64.convert_i32_u (global.get $globaltick))
+            (f64.promote_f32 (f32.load (global.get $VAL)))
+        )
+        (f64.promote_f32 (call $input (i32.const {{.InputNumber "ramp" "phase"}})))
+    ))
+    (global.set $VAL (i32.add (global.get $VAL) (i32.const 4)))
+    (local.set $val (f32.mul ;; g*(x-n), where n is the number of full periods
+        (f32.demote_f64 (f64.sub (local.get $x) (f64.nearest (f64.sub (local.get $x) (f64.const 0.5)))))
+        (call $input (i32.const {{.InputNumber "ramp" "gain"}}))
+    ))
+{{- if .Stereo "ramp"}}
+    (if (local.get $stereo) (then
+        (call $push (local.get $val))
+    ))
+{{- end}}
+    (call $push (local.get $val))
+)
+{{end}}
+
+
+{{- if .HasOp "random"}}
+;;-------------------------------------------------------------------------------
+;;   RANDOM opcode: sample and hold a random value, with optional smoothing
+;;-------------------------------------------------------------------------------
+;;   Mono:   push the held random value on stack
+;;   Stereo: push two (different) held random values on stack
+;;-------------------------------------------------------------------------------
+(func $su_op_random (param $stereo i32) (local $step f32)
+    ;; step = round(t*i-.5)+1, where i is the step increment per sample. The +1
+    ;; makes a fresh unit always draw a value.
+    (local.set $step (f32.add
+        (f32.demote_f64 (f64.nearest (f64.sub
+            (f64.mul
+                (f64.convert_i32_u (global.get $globaltick))
+                (f64.promote_f32 (f32.load (global.get $VAL)))
+            )
+            (f64.const 0.5)
+        )))
+        (f32.const 1)
+    ))
+    (global.set $VAL (i32.add (global.get $VAL) (i32.const 4)))
+{{- if .Stereo "random"}}
+    (if (local.get $stereo) (then
+        (global.set $WRK (i32.add (global.get $WRK) (i32.const 16)))
+        (call $su_op_random_do (local.get $step))
+        (global.set $WRK (i32.sub (global.get $WRK) (i32.const 16)))
+    ))
+{{- end}}
+    (call $su_op_random_do (local.get $step))
+)
+
+(func $su_op_random_do (param $step f32) (local $y f32)
+    (if (f32.ne (f32.load (global.get $WRK)) (local.get $step)) (then
+        (f32.store (global.get $WRK) (local.get $step))
+        (global.set $randseed (i32.mul (global.get $randseed) (i32.const 16007)))
+        (f32.store offset=4 (global.get $WRK) (f32.div (f32.convert_i32_s (global.get $randseed)) (f32.const -2147483648)))
+    ))
+    (f32.store offset=8 (global.get $WRK) (local.tee $y (f32.add ;; y'=y+a*(h-y), where h is the held value
+        (f32.mul
+            (call $nonLinearMap (i32.const {{.InputNumber "random" "smooth"}}))
+            (f32.sub (f32.load offset=4 (global.get $WRK)) (f32.load offset=8 (global.get $WRK)))
+        )
+        (f32.load offset=8 (global.get $WRK))
+    )))
+    (call $push (f32.mul (local.get $y) (call $input (i32.const {{.InputNumber "random" "gain"}}))))
+)
+{{end}}
+
+
 {{- if .HasOp "oscillator"}}
 ;;-------------------------------------------------------------------------------
 ;;   OSCILLAT opcode: oscillator, the heart of the synth
@@ -110,6 +247,9 @@
 {{- if .SupportsModulation "oscillator" "frequency"}}
     (local $freqMod f32)
 {{- end}}
+{{- if (or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA))}}
+    (local $dt f32)
+{{- end}}
 {{- if .Stereo "oscillator"}}
     (local $WRK_stereostash i32)
     (local.set $WRK_stereostash (global.get $WRK))
@@ -153,6 +293,10 @@
                         (f32.const 0.000092696138) ;; scaling constant to get middle-C to where it should be
                         (i32.and (local.get $flags) (i32.const 0x8))
                     ))
+{{- if (or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA))}}
+                    (local.tee $dt)
+                    (local.set $dt (f32.min (local.get $dt) (f32.const 0.5))) ;; phase increment without frequency modulation, needed by the anti-aliased oscillators
+{{- end}}
 {{- if .SupportsModulation "oscillator" "frequency"}}
                     (f32.add (local.get $freqMod))
 {{- end}}
@@ -171,17 +315,39 @@
     ))
 {{- end}}
 {{- if .SupportsParamValue "oscillator" "type" .Trisaw}}
+{{- if .SupportsParamValue "oscillator" "type" .TrisawAA}}
+    (if (i32.eq (i32.and (local.get $flags) (i32.const 0x24)) (i32.const 0x20)) (then
+{{- else}}
     (if (i32.and (local.get $flags) (i32.const 0x20)) (then
+{{- end}}
         (local.set $amplitude (call $oscillator_trisaw (local.get $phase) (local.get $color)))
     ))
 {{- end}}
 {{- if .SupportsParamValue "oscillator" "type" .Pulse}}
+{{- if .SupportsParamValue "oscillator" "type" .PulseAA}}
+    (if (i32.eq (i32.and (local.get $flags) (i32.const 0x14)) (i32.const 0x10)) (then
+{{- else}}
     (if (i32.and (local.get $flags) (i32.const 0x10)) (then
+{{- end}}
         (local.set $amplitude (call $oscillator_pulse (local.get $phase) (local.get $color)))
     ))
 {{- end}}
+{{- if .SupportsParamValue "oscillator" "type" .TrisawAA}}
+    (if (i32.eq (i32.and (local.get $flags) (i32.const 0x24)) (i32.const 0x24)) (then ;; gate bit together with trisaw bit means anti-aliased
+        (local.set $amplitude (call $oscillator_trisaw_aa (local.get $phase) (local.get $color) (local.get $dt)))
+    ))
+{{- end}}
+{{- if .SupportsParamValue "oscillator" "type" .PulseAA}}
+    (if (i32.eq (i32.and (local.get $flags) (i32.const 0x14)) (i32.const 0x14)) (then ;; gate bit together with pulse bit means anti-aliased
+        (local.set $amplitude (call $oscillator_pulse_aa (local.get $phase) (local.get $color) (local.get $dt)))
+    ))
+{{- end}}
 {{- if .SupportsParamValue "oscillator" "type" .Gate}}
+{{- if or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA)}}
+    (if (i32.eq (i32.and (local.get $flags) (i32.const 0xF4)) (i32.const 0x04)) (then ;; the anti-aliased oscillators also have the gate bit
+{{- else}}
     (if (i32.and (local.get $flags) (i32.const 0x04)) (then
+{{- end}}
         (local.set $amplitude (call $oscillator_gate (local.get $phase)))
         ;; wave shaping is skipped with gate
     )(else
@@ -225,7 +391,7 @@
 {{- end}}
 )
 
-{{- if .SupportsParamValue "oscillator" "type" .Pulse}}
+{{- if or (.SupportsParamValue "oscillator" "type" .Pulse) (.SupportsParamValue "oscillator" "type" .PulseAA)}}
 (func $oscillator_pulse (param $phase f32) (param $color f32) (result f32)
     (select
         (f32.const -1)
@@ -251,7 +417,7 @@
 )
 {{end}}
 
-{{- if .SupportsParamValue "oscillator" "type" .Trisaw}}
+{{- if or (.SupportsParamValue "oscillator" "type" .Trisaw) (.SupportsParamValue "oscillator" "type" .TrisawAA)}}
 (func $oscillator_trisaw (param $phase f32) (param $color f32) (result f32)
     (if (f32.ge (local.get $phase) (local.get $color)) (then
         (local.set $phase (f32.sub (f32.const 1) (local.get $phase)))
@@ -263,6 +429,57 @@
 )
 {{end}}
 
+{{- if .SupportsParamValue "oscillator" "type" .TrisawAA}}
+;; trisaw with the corners smoothed using polyBLAMP
+(func $oscillator_trisaw_aa (param $phase f32) (param $color f32) (param $dt f32) (result f32) (local $u0 f32) (local $uc f32)
+    ;; limit color so that both slopes are at least one sample long
+    (local.set $color (f32.min (f32.max (local.get $color) (local.get $dt)) (f32.sub (f32.const 1) (local.get $dt))))
+    (local.set $u0 (f32.abs (call $blep (local.get $phase) (local.get $dt))))
+    (local.set $uc (f32.abs (call $blep (f32.sub (local.get $phase) (local.get $color)) (local.get $dt))))
+    (call $oscillator_trisaw (local.get $phase) (local.get $color))
+    (f32.add (f32.div ;; the slopes change by 2/(c*(1-c)) at the corners and the integrated polyBLEP residual is u^3/6
+        (f32.mul
+            (f32.sub
+                (f32.mul (local.get $u0) (f32.mul (local.get $u0) (local.get $u0)))
+                (f32.mul (local.get $uc) (f32.mul (local.get $uc) (local.get $uc)))
+            )
+            (local.get $dt)
+        )
+        (f32.mul (f32.const 3) (f32.mul (local.get $color) (f32.sub (f32.const 1) (local.get $color))))
+    ))
+)
+{{end}}
+
+{{- if .SupportsParamValue "oscillator" "type" .PulseAA}}
+;; pulse with the edges smoothed using polyBLEP
+(func $oscillator_pulse_aa (param $phase f32) (param $color f32) (param $dt f32) (result f32) (local $u0 f32) (local $uc f32)
+    (local.set $u0 (call $blep (local.get $phase) (local.get $dt)))
+    (local.set $uc (call $blep (f32.sub (local.get $phase) (local.get $color)) (local.get $dt)))
+    (call $oscillator_pulse (local.get $phase) (local.get $color))
+    (f32.sub (f32.mul (local.get $u0) (f32.abs (local.get $u0)))) ;; the polyBLEP residual of a step of height 2 is u*|u|
+    (f32.add (f32.mul (local.get $uc) (f32.abs (local.get $uc))))
+)
+{{end}}
+
+{{- if (or (.SupportsParamValue "oscillator" "type" .TrisawAA) (.SupportsParamValue "oscillator" "type" .PulseAA))}}
+;; returns sign(w)*max(1-|w|/dt,0), where w is the distance x to the discontinuity wrapped to [-.5,.5]
+(func $blep (param $x f32) (param $dt f32) (result f32)
+    (f32.copysign
+        (f32.max
+            (f32.sub
+                (f32.const 1)
+                (f32.div
+                    (f32.abs (local.tee $x (f32.sub (local.get $x) (f32.nearest (local.get $x)))))
+                    (local.get $dt)
+                )
+            )
+            (f32.const 0)
+        )
+        (local.get $x)
+    )
+)
+{{end}}
+
 {{- if .SupportsParamValue "oscillator" "type" .Gate}}
 (func $oscillator_gate (param $phase f32) (result f32) (local $x f32)
     (f32.store offset=16 (global.get $WRK)
@@ -305,6 +522,175 @@
 {{end}}
 
 
+{{- if .HasOp "wavetable"}}
+;;-------------------------------------------------------------------------------
+;;   WAVETABLE opcode: oscillator playing user defined single cycle waveforms
+;;-------------------------------------------------------------------------------
+;;   Mono:   push the wavetable value on stack, interpolated linearly between
+;;           the samples and between the two frames around the position
+;;   Stereo: push l r on stack, where l has opposite detune compared to r
+;;-------------------------------------------------------------------------------
+(func $su_op_wavetable (param $stereo i32) (local $table i32) (local $length i32) (local $frames i32) (local $detune f32) (local $phase f32) (local $y f32) (local $frame i32) (local $a f32)
+{{- if .Stereo "wavetable"}}
+    (local $WRK_stereostash i32)
+    (local.set $WRK_stereostash (global.get $WRK))
+{{- end}}
+    (local.set $table (i32.add
+        (i32.const {{index .Labels "su_wavetables"}})
+        (i32.shl (i32.or (call $scanOperand) (i32.shl (call $scanOperand) (i32.const 8))) (i32.const 1))
+    ))
+    (local.set $length (call $scanOperand))
+    (local.set $frames (call $scanOperand)) ;; actually the number of frames minus 1
+    (local.set $detune (call $inputSigned (i32.const {{.InputNumber "wavetable" "detune"}})))
+{{- if .Stereo "wavetable"}}
+    loop $stereoLoop
+{{- end}}
+    (f32.store ;; update phase
+        (global.get $WRK)
+        (local.tee $phase
+            (f32.sub
+                (local.tee $phase
+                    (f32.div
+                        (call $inputSigned (i32.const {{.InputNumber "wavetable" "transpose"}}))
+                        (f32.const 0.015625)
+                    ) ;; scale back to 0 - 128
+                    (f32.add (local.get $detune))
+                    (f32.add (f32.convert_i32_u (i32.load (global.get $voice))))
+                    (f32.mul (f32.const 0.0833333)) ;; /12, in full octaves
+                    (call $pow2)
+                    (f32.mul (f32.const 0.000092696138)) ;; scaling constant to get middle-C to where it should be
+                    (f32.add (f32.load (global.get $WRK))) ;; add the current phase of the oscillator
+                )
+                (f32.floor (local.get $phase))
+            )
+        )
+    )
+    (local.set $y (f32.mul
+        (f32.min (f32.max (call $input (i32.const {{.InputNumber "wavetable" "position"}})) (f32.const 0)) (f32.const 1))
+        (f32.convert_i32_u (local.get $frames))
+    ))
+    (local.set $frame (i32.trunc_f32_u (local.get $y)))
+    (local.set $y (f32.sub (local.get $y) (f32.convert_i32_u (local.get $frame))))
+    (local.set $a (call $wavetable_lerp
+        (i32.add (local.get $table) (i32.shl (i32.mul (local.get $frame) (local.get $length)) (i32.const 1)))
+        (local.get $length)
+        (local.get $phase)
+    ))
+    (call $push (f32.mul
+        (f32.add
+            (local.get $a)
+            (f32.mul
+                (f32.sub
+                    (call $wavetable_lerp ;; the next frame, or the same frame if this is the last one
+                        (i32.add (local.get $table) (i32.shl (i32.mul
+                            (i32.add (local.get $frame) (i32.lt_u (local.get $frame) (local.get $frames)))
+                            (local.get $length)
+                        ) (i32.const 1)))
+                        (local.get $length)
+                        (local.get $phase)
+                    )
+                    (local.get $a)
+                )
+                (local.get $y)
+            )
+        )
+        (f32.mul (call $input (i32.const {{.InputNumber "wavetable" "gain"}})) (f32.const 0.0078125)) ;; the samples are -128...127
+    ))
+{{- if .Stereo "wavetable"}}
+    (local.set $detune (f32.neg (local.get $detune))) ;; flip the detune for second round
+    (global.set $WRK (i32.add (global.get $WRK) (i32.const 4)))
+    (br_if $stereoLoop (i32.eqz (local.tee $stereo (i32.eqz (local.get $stereo)))))
+    end
+    (global.set $WRK (local.get $WRK_stereostash))
+{{- end}}
+)
+
+;;-------------------------------------------------------------------------------
+;;   $wavetable_lerp interpolates linearly between the two samples of a frame
+;;   around the phase, the last sample wrapping around to the first
+;;-------------------------------------------------------------------------------
+(func $wavetable_lerp (param $frame i32) (param $length i32) (param $x f32) (result f32) (local $i i32) (local $s f32)
+    (local.set $i (i32.trunc_f32_u (local.tee $x (f32.mul (local.get $x) (f32.convert_i32_u (local.get $length))))))
+    (local.set $x (f32.sub (local.get $x) (f32.convert_i32_u (local.get $i))))
+    (local.set $s (f32.convert_i32_s (i32.load16_s
+        (i32.add (local.get $frame) (i32.shl (i32.rem_u (local.get $i) (local.get $length)) (i32.const 1)))
+    )))
+    (f32.add
+        (local.get $s)
+        (f32.mul
+            (f32.sub
+                (f32.convert_i32_s (i32.load16_s
+                    (i32.add (local.get $frame) (i32.shl (i32.rem_u (i32.add (local.get $i) (i32.const 1)) (local.get $length)) (i32.const 1)))
+                ))
+                (local.get $s)
+            )
+            (local.get $x)
+        )
+    )
+)
+{{end}}
+
+
+{{- if .HasOp "operator"}}
+;;-------------------------------------------------------------------------------
+;;   OPERATOR opcode: sine oscillator with phase modulation input, for FM
+;;-------------------------------------------------------------------------------
+;;   Mono:   x   ->  g*sin(2*pi*(p+x+f*(y1+y2)/4)), where p is the phase and
+;;                   y1, y2 are the two previous outputs before the gain
+;;   Stereo: l r ->  the same for both channels, with separate phases
+;;-------------------------------------------------------------------------------
+(func $su_op_operator (param $stereo i32) (local $flags i32) (local $phase f32) (local $y f32)
+{{- if .Stereo "operator"}}
+    (call $stereoHelper (local.get $stereo) (i32.const {{div (.GetOp "operator") 2}}))
+    (if (local.get $stereo)(then
+        ;; rewind the $VAL one byte backwards as the right channel already scanned it once
+        (global.set $VAL (i32.sub (global.get $VAL) (i32.const 1)))
+    ))
+{{- end}}
+    (local.set $flags (call $scanOperand))
+    (f32.store ;; update phase
+        (global.get $WRK)
+        (local.tee $phase
+            (f32.sub
+                (local.tee $phase
+{{- if .SupportsParamValue "operator" "fixed" 1}}
+                    (select
+                        (f32.const 72) ;; fixed frequency: ignore the note and use the middle C
+                        (f32.convert_i32_u (i32.load (global.get $voice)))
+                        (i32.and (local.get $flags) (i32.const 0x80))
+                    )
+{{- else}}
+                    (f32.convert_i32_u (i32.load (global.get $voice)))
+{{- end}}
+                    (f32.mul (f32.const 0.0833333)) ;; /12, in full octaves
+                    (call $pow2)
+                    (f32.mul (f32.const 0.000092696138)) ;; scaling constant to get middle-C to where it should be
+                    (f32.mul (f32.convert_i32_u (i32.and (local.get $flags) (i32.const 0x7f)))) ;; twice the coarse ratio
+                    (f32.mul (f32.add (call $input (i32.const {{.InputNumber "operator" "fine"}})) (f32.const 1)))
+                    (f32.mul (f32.const 0.5))
+                    (f32.add (f32.load (global.get $WRK))) ;; add the current phase of the operator
+                )
+                (f32.floor (local.get $phase))
+            )
+        )
+    )
+    (local.set $y (call $sin (f32.mul
+        (f32.add
+            (f32.add (local.get $phase) (call $pop))
+            (f32.mul
+                (f32.add (f32.load offset=4 (global.get $WRK)) (f32.load offset=8 (global.get $WRK)))
+                (f32.mul (call $input (i32.const {{.InputNumber "operator" "feedback"}})) (f32.const 0.25))
+            )
+        )
+        (f32.const 6.28318530718)
+    )))
+    (f32.store offset=8 (global.get $WRK) (f32.load offset=4 (global.get $WRK)))
+    (f32.store offset=4 (global.get $WRK) (local.get $y))
+    (call $push (f32.mul (local.get $y) (call $input (i32.const {{.InputNumber "operator" "gain"}}))))
+)
+{{end}}
+
+
 {{- if .HasOp "receive"}}
 ;;-------------------------------------------------------------------------------
 ;;   RECEIVE opcode
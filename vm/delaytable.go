@@ -106,7 +106,7 @@ func findSuperIntArray(arrays [][]int) ([]int, []int) {
 //
 // Returns the delay time table and two dimensional array of integers where
 // element [i][u] is the index for instrument i / unit u in the delay table if
-// the unit was a delay unit. For non-delay untis, the element is just 0.
+// the unit was a delay or reverb unit. For other units, the element is just 0.
 func constructDelayTimeTable(patch sointu.Patch, bpm int) ([]int, [][]int) {
 	ind := make([][]int, len(patch))
 	var subarrays [][]int
@@ -133,6 +133,17 @@ func constructDelayTimeTable(patch sointu.Patch, bpm int) ([]int, [][]int) {
 				}
 				subarrays = append(subarrays, converted)
 			}
+			// reverbs use the table for the lengths of their four lines,
+			// followed by the predelay
+			if unit.Type == "reverb" && !unit.Disabled {
+				ind[i][j] = len(subarrays)
+				times := make([]int, 5)
+				for k := 0; k < 4; k++ {
+					times[k] = sointu.ReverbLineLength(k, unit.Parameters["size"])
+				}
+				times[4] = sointu.ReverbPredelayLength(unit.Parameters["predelay"])
+				subarrays = append(subarrays, times)
+			}
 		}
 	}
 	delayTable, indices := findSuperIntArray(subarrays)
@@ -142,10 +153,47 @@ func constructDelayTimeTable(patch sointu.Patch, bpm int) ([]int, [][]int) {
 	for i, instr := range patch {
 		unitindices[i] = make([]int, len(instr.Units))
 		for j, unit := range instr.Units {
-			if unit.Type == "delay" && !unit.Disabled {
+			if (unit.Type == "delay" || unit.Type == "reverb") && !unit.Disabled {
 				unitindices[i][j] = indices[ind[i][j]]
 			}
 		}
 	}
 	return delayTable, unitindices
 }
+
+// constructWavetableTable constructs the table of wavetable samples, merging
+// identical or overlapping wavetables the same way as the delay times. The
+// samples are stored as 16-bit signed integers, so they can live in the same
+// table as the delay times.
+//
+// Returns the table and two dimensional array of integers where element [i][u]
+// is the index for instrument i / unit u in the table if the unit was a
+// wavetable unit. For other units, the element is just 0.
+func constructWavetableTable(patch sointu.Patch) ([]int, [][]int) {
+	ind := make([][]int, len(patch))
+	var subarrays [][]int
+	for i, instr := range patch {
+		ind[i] = make([]int, len(instr.Units))
+		for j, unit := range instr.Units {
+			if unit.Type == "wavetable" && !unit.Disabled {
+				ind[i][j] = len(subarrays)
+				converted := make([]int, len(unit.VarArgs))
+				for k, v := range unit.VarArgs {
+					converted[k] = int(uint16(int16(v)))
+				}
+				subarrays = append(subarrays, converted)
+			}
+		}
+	}
+	table, indices := findSuperIntArray(subarrays)
+	unitindices := make([][]int, len(patch))
+	for i, instr := range patch {
+		unitindices[i] = make([]int, len(instr.Units))
+		for j, unit := range instr.Units {
+			if unit.Type == "wavetable" && !unit.Disabled {
+				unitindices[i][j] = indices[ind[i][j]]
+			}
+		}
+	}
+	return table, unitindices
+}
@@ -29,6 +29,11 @@ type (
 		state      synthState
 		delaylines []delayline
 		cpuLoad    sointu.CPULoad
+		// oversampling is the number of times each voice is run per sample
+		oversampling [MAX_VOICES]int
+		// heldPorts collects the sends to oversampled voices from other voices,
+		// so that they can be added to the ports on every iteration
+		heldPorts [MAX_VOICES][MAX_UNITS][8]float32
 	}
 
 	// GoSynther is a Synther implementation that can converts patches into
@@ -39,6 +44,8 @@ type (
 
 const MAX_VOICES = 32
 const MAX_UNITS = 63
+const MAX_OVERSAMPLING = 4
+const MAX_WAVETABLE_SAMPLES = 65536 // the wavetable unit addresses the table with 16 bits
 
 type (
 	unit struct {
@@ -56,6 +63,7 @@ type (
 		outputs    [8]float32
 		randSeed   uint32
 		globalTime uint32
+		songTime   uint32 // the position of the song, used by the tempo-synced units
 		voices     [MAX_VOICES]voice
 	}
 
@@ -97,6 +105,7 @@ success:
 
 func (s GoSynther) Name() string                 { return "Go" }
 func (s GoSynther) SupportsMultithreading() bool { return false }
+func (s GoSynther) SupportsOversampling() bool   { return true }
 
 func (s GoSynther) Synth(patch sointu.Patch, bpm int) (sointu.Synth, error) {
 	bytecode, err := NewBytecode(patch, AllFeatures{}, bpm)
@@ -105,6 +114,7 @@ func (s GoSynther) Synth(patch sointu.Patch, bpm int) (sointu.Synth, error) {
 	}
 	ret := &GoSynth{bytecode: *bytecode, stack: make([]float32, 0, 4), delaylines: make([]delayline, patch.NumDelayLines())}
 	ret.state.randSeed = 1
+	ret.setOversampling(patch)
 	return ret, nil
 }
 
@@ -118,6 +128,16 @@ func (s *GoSynth) Release(voiceIndex int) {
 	s.state.voices[voiceIndex].sustain = false
 }
 
+func (s *GoSynth) SetParameter(target sointu.AutomationTarget, value int) {
+	for _, o := range s.bytecode.ParameterOperands(target) {
+		s.bytecode.Operands[o] = byte(value)
+	}
+}
+
+func (s *GoSynth) SetSongTime(time int) {
+	s.state.songTime = uint32(time)
+}
+
 func (s *GoSynth) Close() {}
 
 func (s *GoSynth) CPULoad(loads []sointu.CPULoad) int {
@@ -143,6 +163,7 @@ func (s *GoSynth) Update(patch sointu.Patch, bpm int) error {
 		}
 	}
 	s.bytecode = *bytecode
+	s.setOversampling(patch)
 	for len(s.delaylines) < patch.NumDelayLines() {
 		s.delaylines = append(s.delaylines, delayline{})
 	}
@@ -156,6 +177,18 @@ func (s *GoSynth) Update(patch sointu.Patch, bpm int) error {
 	return nil
 }
 
+// setOversampling sets the oversampling factor of each voice from the
+// instruments of the patch.
+func (s *GoSynth) setOversampling(patch sointu.Patch) {
+	voiceNo := 0
+	for _, instr := range patch {
+		for j := 0; j < instr.NumVoices && voiceNo < MAX_VOICES; j++ {
+			s.oversampling[voiceNo] = min(max(instr.Oversampling, 1), MAX_OVERSAMPLING)
+			voiceNo++
+		}
+	}
+}
+
 func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, renderTime int, renderError error) {
 	startTime := time.Now()
 	defer func() { s.cpuLoad.Update(time.Since(startTime), int64(samples)) }()
@@ -177,13 +210,48 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 		voicesRemaining := s.bytecode.NumVoices
 		voices := s.state.voices[:]
 		units := voices[0].units[:]
+		// an oversampled voice is run factor times per sample, with the time
+		// constants of the units scaled by rate = 1/factor; sub is the
+		// current iteration and tick the time index of its delay lines
+		voiceNo, voiceStart := 0, true
+		factor, sub := 1, 0
+		var rate float32 = 1
+		var tick uint16
+		opcodesVoice, operandsVoice, delaylinesVoice := opcodes, operands, delaylines
 		for voicesRemaining > 0 {
+			if voiceStart {
+				voiceStart = false
+				if sub == 0 {
+					opcodesVoice, operandsVoice, delaylinesVoice = opcodes, operands, delaylines
+					factor = max(s.oversampling[voiceNo], 1)
+					rate = 1 / float32(factor)
+				}
+				tick = uint16(s.state.globalTime*uint32(factor) + uint32(sub))
+				if factor > 1 {
+					for i := range voices[0].units {
+						for j, v := range s.heldPorts[voiceNo][i] {
+							voices[0].units[i].ports[j] += v
+						}
+					}
+				}
+			}
 			op := opcodes[0]
 			opcodes = opcodes[1:]
 			channels := int((op & 1) + 1)
 			stereo := channels == 2
 			opNoStereo := (op & 0xFE) >> 1
 			if opNoStereo == 0 {
+				voiceStart = true
+				if sub++; sub < factor { // run the voice again
+					opcodes, operands, delaylines = opcodesVoice, operandsVoice, delaylinesVoice
+					units = voices[0].units[:]
+					continue
+				}
+				if factor > 1 {
+					s.heldPorts[voiceNo] = [MAX_UNITS][8]float32{}
+				}
+				sub = 0
+				voiceNo++
 				voicesRemaining--
 				if voicesRemaining > 0 {
 					voices = voices[1:]
@@ -273,6 +341,10 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 				}
 				stack = append(stack, val)
 			case opOut:
+				if factor > 1 && !decimate(stack[l-channels:], unit.state[:], factor, sub) {
+					stack = stack[:l-channels]
+					break
+				}
 				if stereo {
 					synth.outputs[0] += params[0] * stack[l-1]
 					synth.outputs[1] += params[0] * stack[l-2]
@@ -282,6 +354,10 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 					stack = stack[:l-1]
 				}
 			case opOutaux:
+				if factor > 1 && !decimate(stack[l-channels:], unit.state[:], factor, sub) {
+					stack = stack[:l-channels]
+					break
+				}
 				if stereo {
 					synth.outputs[0] += params[0] * stack[l-1]
 					synth.outputs[1] += params[0] * stack[l-2]
@@ -296,13 +372,17 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 			case opAux:
 				var channel byte
 				channel, operands = operands[0], operands[1:]
+				if factor > 1 && !decimate(stack[l-channels:], unit.state[:], factor, sub) {
+					stack = stack[:l-channels]
+					break
+				}
 				if stereo {
 					synth.outputs[channel+1] += params[0] * stack[l-2]
 				}
 				synth.outputs[channel] += params[0] * stack[l-1]
 				stack = stack[:l-channels]
 			case opSpeed:
-				r := unit.state[0] + float32(math.Exp2(float64(stack[l-1]*2.206896551724138))-1)
+				r := unit.state[0] + float32(math.Exp2(float64(stack[l-1]*2.206896551724138))-1)*rate
 				w := int(r+1.5) - 1
 				unit.state[0] = r - float32(w)
 				renderTime += w
@@ -310,32 +390,40 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 			case opIn:
 				var channel byte
 				channel, operands = operands[0], operands[1:]
+				// an oversampled voice reads the same input on every iteration
 				if stereo {
 					stack = append(stack, synth.outputs[channel+1])
-					synth.outputs[channel+1] = 0
+					if sub == factor-1 {
+						synth.outputs[channel+1] = 0
+					}
 				}
 				stack = append(stack, synth.outputs[channel])
-				synth.outputs[channel] = 0
+				if sub == factor-1 {
+					synth.outputs[channel] = 0
+				}
 			case opEnvelope:
-				if !voices[0].sustain {
+				var curves []byte
+				curves, operands = operands[:3], operands[3:]
+				if !voices[0].sustain && unit.state[0] != envStateRelease {
 					unit.state[0] = envStateRelease // set state to release
+					unit.state[2] = unit.state[1]   // the level where the release started
 				}
 				state := unit.state[0]
 				level := unit.state[1]
 				switch state {
 				case envStateAttack:
-					level += nonLinearMap(params[0])
+					level += nonLinearMap(params[0]) * envelopeCurve(curves[0], 1-level, 1) * rate
 					if level >= 1 {
 						level = 1
 						state = envStateDecay
 					}
 				case envStateDecay:
-					level -= nonLinearMap(params[1])
+					level -= nonLinearMap(params[1]) * envelopeCurve(curves[1], level-params[2], 1-params[2]) * rate
 					if sustain := params[2]; level <= sustain {
 						level = sustain
 					}
 				case envStateRelease:
-					level -= nonLinearMap(params[3])
+					level -= nonLinearMap(params[3]) * envelopeCurve(curves[2], level, unit.state[2]) * rate
 					if level <= 0 {
 						level = 0
 					}
@@ -354,6 +442,32 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 				}
 				value := waveshape(synth.rand(), params[0]) * params[1]
 				stack = append(stack, value)
+			case opRandom:
+				inc := math.Float32frombits(binary.LittleEndian.Uint32(operands))
+				operands = operands[4:]
+				// the index of the current step, plus one so that a fresh unit
+				// always draws a value on the first sample
+				time := float64(synth.songTime) + float64(sub)*float64(rate)
+				step := float32(math.RoundToEven(time*float64(inc)-0.5)) + 1
+				alpha := nonLinearMap(params[0]) * rate
+				for i := channels - 1; i >= 0; i-- {
+					state := unit.state[i*4 : i*4+3]
+					if state[0] != step {
+						state[0] = step
+						state[1] = synth.rand()
+					}
+					state[2] += (state[1] - state[2]) * alpha
+					stack = append(stack, state[2]*params[1])
+				}
+			case opRamp:
+				inc := math.Float32frombits(binary.LittleEndian.Uint32(operands))
+				operands = operands[4:]
+				x := (float64(synth.songTime)+float64(sub)*float64(rate))*float64(inc) + float64(params[0])
+				val := float32(x-math.RoundToEven(x-0.5)) * params[1] // the fractional part, rounded like the x87 does
+				if stereo {
+					stack = append(stack, val)
+				}
+				stack = append(stack, val)
 			case opGain:
 				if stereo {
 					stack[l-2] *= params[0]
@@ -375,13 +489,20 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 					stack[l-2] = clip(stack[l-2])
 				}
 				stack[l-1] = clip(stack[l-1])
+			case opMath:
+				var flags byte
+				flags, operands = operands[0], operands[1:]
+				if stereo {
+					stack[l-2] = mathFunction(stack[l-2], flags)
+				}
+				stack[l-1] = mathFunction(stack[l-1], flags)
 			case opCrush:
 				if stereo {
 					stack[l-2] = crush(stack[l-2], params[0])
 				}
 				stack[l-1] = crush(stack[l-1], params[0])
 			case opHold:
-				freq2 := params[0] * params[0]
+				freq2 := params[0] * params[0] * rate
 				for i := 0; i < channels; i++ {
 					phase := unit.state[i] - freq2
 					if phase <= 0 {
@@ -403,8 +524,15 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 				unitIndex := ((addr & 0x01F0) >> 4) - 1
 				port := addr & 7
 				amount := params[0]*2 - 1
+				ports := &targetVoice.units[unitIndex].ports
+				if targetVoice != voice {
+					amount *= rate // sends to other voices are averaged over the iterations
+					if targetNo := int(addr >> 10); s.oversampling[targetNo] > 1 {
+						ports = &s.heldPorts[targetNo][unitIndex]
+					}
+				}
 				for i := 0; i < channels; i++ {
-					targetVoice.units[unitIndex].ports[int(port)+i] += stack[l-1-i] * amount
+					ports[int(port)+i] += stack[l-1-i] * amount
 				}
 				if addr&0x8 == 0x8 {
 					stack = stack[:l-channels]
@@ -429,8 +557,80 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 				}
 				stack[l-2] *= params[0]
 				stack[l-1] *= 1 - params[0]
+			case opMidside:
+				var flags byte
+				flags, operands = operands[0], operands[1:]
+				x, y := stack[l-1], stack[l-2] // l r, or m s when decoding
+				if flags&1 != 0 {
+					x, y = (x+y)*0.5, (x-y)*0.5
+				}
+				y *= params[0] * 2
+				if flags&2 != 0 {
+					x, y = x+y, x-y
+				}
+				stack[l-1], stack[l-2] = x, y
+			case opLadder:
+				g := math.Tan(1.5393804 * float64(params[0]*params[0]*rate)) // the cutoff goes up to 0.49 times the sample rate
+				gg := g / (1 + g)
+				k := float64(params[1]) * 5 // self-oscillates above k = 4
+				drive := 1 + float64(params[2])*15
+				for i := 0; i < channels; i++ {
+					st := unit.state[i*4 : i*4+4]
+					// zero delay feedback: solve the input of the first stage
+					// from the part of the output that does not depend on it
+					sum := (((float64(st[0])*gg+float64(st[1]))*gg+float64(st[2]))*gg + float64(st[3])) * (1 - gg)
+					u := ladderSaturate((drive*float64(stack[l-1-i]) - k*sum) / (1 + k*gg*gg*gg*gg))
+					for j := range st {
+						v := (u - float64(st[j])) * gg
+						u = v + float64(st[j])
+						st[j] = float32(u + v)
+					}
+					stack[l-1-i] = float32(u)
+				}
+			case opPhaser:
+				var stages byte
+				stages, operands = operands[0], operands[1:]
+				g := math.Tan(1.5393804 * float64(params[0]*params[0]*rate)) // the frequency goes up to 0.49 times the sample rate
+				a := (g - 1) / (g + 1)                                       // each stage outputs s+a*(u-s), where u is the input and s the state
+				k := (float64(params[1])*2 - 1) * 0.99
+				for i := 0; i < channels; i++ {
+					st := unit.state[i*4 : i*4+int(stages)]
+					// the output of the chain is ga*u+gb. Zero delay feedback:
+					// solve u=x+k*(ga*u+gb)
+					ga, gb := 1.0, 0.0
+					for _, state := range st {
+						ga *= a
+						gb = gb*a + float64(state)
+					}
+					gb *= 1 - a
+					x := stack[l-1-i]
+					u := (float64(x) + k*gb) / (1 - k*ga)
+					for j := range st {
+						d := u - float64(st[j])
+						u = float64(st[j]) + a*d
+						st[j] = float32(u + d)
+					}
+					stack[l-1-i] = params[2]*x + float32(u)
+				}
+			case opOperator:
+				var flags byte
+				flags, operands = operands[0], operands[1:]
+				note := float64(voice.note)
+				if flags&0x80 == 0x80 { // fixed frequency: ignore the note and use the middle C
+					note = 72
+				}
+				omega := math.Exp2(note*0.083333333333) * 0.000092696138 * float64(flags&0x7f) * 0.5 * float64(1+params[0]) * float64(rate)
+				for i := 0; i < channels; i++ {
+					phase := float64(unit.state[i]) + omega
+					phase -= math.Floor(phase)
+					unit.state[i] = float32(phase)
+					feedback := params[1] * (unit.state[2+i] + unit.state[4+i]) * 0.25
+					y := float32(math.Sin(2 * math.Pi * (phase + float64(stack[l-1-i]+feedback))))
+					unit.state[2+i], unit.state[4+i] = y, unit.state[2+i]
+					stack[l-1-i] = y * params[2]
+				}
 			case opFilter:
-				freq2 := params[0] * params[0]
+				freq2 := params[0] * params[0] * rate
 				res := params[1]
 				var flags byte
 				flags, operands = operands[0], operands[1:]
@@ -458,6 +658,34 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 					}
 					stack[l-1-i] = output
 				}
+			case opFormant:
+				pos := (clip(params[0]*2-1) + 1) * 2
+				vowel := min(int(math.RoundToEven(float64(pos)-0.5)), 3)
+				frac := pos - float32(vowel)
+				table := FormantTable[vowel*3:]
+				var coefs [3]float32 // the coefficients of the two formants and the gain of the second formant
+				for i := range coefs {
+					a, b := float32(table[i]), float32(table[i+3])
+					coefs[i] = (a + (b-a)*frac) / 32768
+				}
+				coefs[0] *= rate
+				coefs[1] *= rate
+				res := params[1]
+				for i := 0; i < channels; i++ {
+					var output float32
+					for j := 0; j < 2; j++ {
+						low, band := unit.state[i*4+j*2], unit.state[i*4+j*2+1]
+						low += coefs[j] * band
+						high := stack[l-1-i] - low - res*band
+						band += coefs[j] * high
+						unit.state[i*4+j*2], unit.state[i*4+j*2+1] = low, band
+						if j == 1 {
+							band *= coefs[2]
+						}
+						output += band
+					}
+					stack[l-1-i] = output * res // scaling by the resonance keeps the gain at the formants constant
+				}
 			case opOscillator:
 				var flags byte
 				flags, operands = operands[0], operands[1:]
@@ -479,7 +707,9 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 						} else {
 							omega *= 0.000038 //  pretty random scaling constant to get LFOs into reasonable range. Historical reasons, goes all the way back to 4klang
 						}
-						omega += float64(unit.ports[6]) // add frequency modulation
+						omega *= float64(rate)
+						dt := math.Min(omega, 0.5)             // phase increment per sample, without frequency modulation, used by the anti-aliased oscillators
+						omega += float64(unit.ports[6] * rate) // add frequency modulation
 						var amplitude float32
 						phase := float64(*statevar) + omega
 						if flags&0x80 == 0x80 { // if this is a sample oscillator
@@ -511,16 +741,16 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 									amplitude = float32(math.Sin(2 * math.Pi * phase / color))
 								}
 							case flags&0x20 == 0x20: // Trisaw
-								if phase >= color { // since phase cannot be 1, if color = 1, then this condition never fires
-									phase = 1 - phase
-									color = 1 - color
+								if flags&0x4 == 0x4 { // anti-aliased
+									amplitude = float32(trisawAA(phase, color, dt))
+								} else {
+									amplitude = float32(trisaw(phase, color))
 								}
-								amplitude = float32(phase/color*2 - 1)
 							case flags&0x10 == 0x10: // Pulse
-								if phase >= color {
-									amplitude = -1
+								if flags&0x4 == 0x4 { // anti-aliased
+									amplitude = float32(pulseAA(phase, color, dt))
 								} else {
-									amplitude = 1
+									amplitude = float32(pulse(phase, color))
 								}
 							case flags&0x4 == 0x4: // Gate
 								maskLow, maskHigh := operandsAtTransform[3], operandsAtTransform[4]
@@ -531,7 +761,7 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 								unit.state[4+i] = amplitude
 							}
 						}
-						if flags&0x4 == 0 {
+						if flags&0x4 == 0 || flags&0x30 != 0 { // gate skips the waveshaping, but the anti-aliased oscillators also have the gate bit set
 							output += waveshape(amplitude, params[4]) * params[5]
 						} else {
 							output += amplitude * params[5]
@@ -545,14 +775,44 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 					detuneStereo = -detuneStereo
 				}
 				unit.ports[6] = 0
+			case opWavetable:
+				index := int(operands[0]) + int(operands[1])<<8
+				length, frames := int(operands[2]), int(operands[3]) // frames is actually the number of frames minus 1
+				operands = operands[4:]
+				table := s.bytecode.Wavetables[index:]
+				detune := params[1]*2 - 1
+				position := math.Min(math.Max(float64(params[2]), 0), 1)
+				for i := 0; i < channels; i++ {
+					pitch := float64(64*(params[0]*2-1)+detune) + float64(voice.note)
+					omega := math.Exp2(pitch*0.083333333333) * 0.000092696138 * float64(rate)
+					phase := float64(unit.state[i]) + omega
+					phase -= math.Floor(phase)
+					unit.state[i] = float32(phase)
+					frame, fy := wavetableSplit(position * float64(frames))
+					sample, fx := wavetableSplit(phase * float64(length))
+					a := wavetableLerp(table[frame*length:], length, sample, fx)
+					if frame < frames {
+						frame++
+					}
+					b := wavetableLerp(table[frame*length:], length, sample, fx)
+					stack = append(stack, float32(a+(b-a)*fy)*params[3]*0.0078125)
+					detune = -detune
+				}
 			case opDelay:
 				pregain2 := params[0] * params[0]
-				damp := params[3]
+				damp := oversampledPole(params[3], rate)
 				feedback := params[2]
-				var index, count byte
-				index, count, operands = operands[0], operands[1], operands[2:]
-				t := uint16(s.state.globalTime)
+				var index, count, pingpong byte
+				index, count, pingpong, operands = operands[0], operands[1], operands[2], operands[3:]
+				t := tick
+				lines := delaylines
 				stackIndex := l - channels
+				feeds := [2]float32{stack[stackIndex], stack[l-1]}
+				if pingpong > 0 { // ping-pong: the mono sum is split between the lines of the channels, the spread moving it towards the left channel
+					half := (stack[l-2] + stack[l-1]) * 0.25 // half of the mono sum, so the feeds always add up to the mono sum
+					side := half * (float32(pingpong-1) / 128)
+					feeds = [2]float32{half - side, side + half}
+				}
 				for i := 0; i < channels; i++ {
 					var d *delayline
 					signal := stack[stackIndex]
@@ -563,19 +823,141 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 						if count&1 == 0 {
 							delay /= float32(math.Exp2(float64(voice.note) * 0.083333333333))
 						}
+						if factor > 1 {
+							delay = min(delay*float32(factor), 65535)
+						}
 						delSignal := d.buffer[t-uint16(delay+0.5)]
 						output += delSignal
 						d.dampState = damp*d.dampState + (1-damp)*delSignal
-						d.buffer[t] = feedback*d.dampState + pregain2*signal
+						d.buffer[t] = feedback*d.dampState + pregain2*feeds[i]
 						index++
 					}
-					d.dcFiltState = output + (0.99609375*d.dcFiltState - d.dcIn)
+					d.dcFiltState = output + (oversampledPole(0.99609375, rate)*d.dcFiltState - d.dcIn)
 					d.dcIn = output
 					stack[stackIndex] = d.dcFiltState
 					stackIndex++
 				}
+				if pingpong > 0 { // cross the feedback by swapping the samples just written to the right and left lines
+					n := (int(count) + 1) / 2
+					for j := 0; j < n; j++ {
+						lines[j].buffer[t], lines[n+j].buffer[t] = lines[n+j].buffer[t], lines[j].buffer[t]
+					}
+				}
 				unit.ports[4] = 0
+			case opPluck:
+				detune := params[1]*2 - 1
+				damp := oversampledPole(params[3]*0.99609375, rate)
+				c := 1 - params[2]
+				feedback := 1 - c*c*c*c
+				t := tick
+				for i := channels - 1; i >= 0; i-- { // the right channel is processed first; the left channel gets the opposite detune
+					var d *delayline
+					d, delaylines = &delaylines[0], delaylines[1:]
+					pitch := float64(64*(params[0]*2-1)+detune) + float64(voice.note)
+					// the damping filter delays the signal by damp/(1-damp) samples
+					// at low frequencies, so subtract it to keep the pluck in tune
+					length := float64(factor)/(math.Exp2(pitch*0.083333333333)*0.000092696138) - float64(damp/(1-damp))
+					length = math.Max(length, 1)
+					n := math.Floor(length)
+					f := float32(length - n)
+					s0 := d.buffer[t-uint16(int(n))]
+					s1 := d.buffer[t-uint16(int(n))-1]
+					delSignal := s0 + (s1-s0)*f
+					d.dampState = delSignal + (d.dampState-delSignal)*damp
+					y := stack[l-1-i] + feedback*d.dampState
+					d.buffer[t] = y
+					stack[l-1-i] = y
+					detune = -detune
+				}
+			case opChorus:
+				phase := float64(unit.state[0] + params[0]*params[0]*0.00022675737*rate) // max rate is 10 Hz
+				phase -= math.Floor(phase)
+				unit.state[0] = float32(phase)
+				feedback := (params[3]*2 - 1) * 0.99
+				t := tick
+				for i := channels - 1; i >= 0; i-- { // the right channel is processed first, with the LFO ahead by the spread
+					var d *delayline
+					d, delaylines = &delaylines[0], delaylines[1:]
+					lfoPhase := phase + float64(params[4])*0.5*float64(i)
+					length := (1 + 1024*float64(params[2]) + 512*float64(params[1])*(1+math.Sin(2*math.Pi*lfoPhase))) * float64(factor)
+					n := math.Floor(length)
+					f := float32(length - n)
+					s0 := d.buffer[t-uint16(int(n))]
+					s1 := d.buffer[t-uint16(int(n))-1]
+					delSignal := s0 + (s1-s0)*f
+					x := stack[l-1-i]
+					d.buffer[t] = x + feedback*delSignal
+					stack[l-1-i] = x + params[5]*delSignal
+				}
+			case opReverb:
+				var index byte
+				index, operands = operands[0], operands[1:]
+				times := s.bytecode.DelayTimes[index:] // the lengths of the four lines, followed by the predelay
+				t := tick
+				phase := float64(unit.state[0] + 0.000011337868*rate) // the lines are modulated by a 0.5 Hz LFO
+				phase -= math.Floor(phase)
+				unit.state[0] = float32(phase)
+				lines := delaylines[:5]
+				delaylines = delaylines[5:]
+				input := stack[l-1]
+				if stereo {
+					input = (stack[l-1] + stack[l-2]) * 0.5
+				}
+				lines[4].buffer[t] = input
+				predelayed := lines[4].buffer[t-times[4]*uint16(factor)]
+				damp := oversampledPole(params[1], rate)
+				var o [4]float32
+				for i := range o {
+					d := &lines[i]
+					length := (float64(times[i]) + 16*float64(params[2])*math.Sin(2*math.Pi*(phase+float64(i)*0.25))) * float64(factor)
+					n := math.Floor(length)
+					f := float32(length - n)
+					s0 := d.buffer[t-uint16(int(n))]
+					s1 := d.buffer[t-uint16(int(n))-1]
+					d.dampState = damp*d.dampState + (1-damp)*(s0+(s1-s0)*f)
+					o[i] = d.dampState
+				}
+				// mix the lines with a 4x4 Hadamard matrix, scaled by 1/2 to
+				// keep it orthogonal, so the feedback alone sets the decay
+				h := (1 - (1-params[0])*(1-params[0])) * 0.5
+				a, b, c, e := o[0]+o[1], o[0]-o[1], o[2]+o[3], o[2]-o[3]
+				lines[0].buffer[t] = (a+c)*h + predelayed
+				lines[1].buffer[t] = (b+e)*h + predelayed
+				lines[2].buffer[t] = (a-c)*h + predelayed
+				lines[3].buffer[t] = (b-e)*h + predelayed
+				stack[l-1] = params[3]*stack[l-1] + params[4]*(o[0]-o[3])
+				if stereo {
+					stack[l-2] = params[3]*stack[l-2] + params[4]*(o[1]-o[2])
+				}
+			case opLimiter:
+				var lookahead byte
+				lookahead, operands = operands[0], operands[1:]
+				length := (int(lookahead)*2 + 1) * factor
+				t := tick
+				var r *delayline
+				r, delaylines = &delaylines[0], delaylines[1:]
+				peak := float32(0)
+				for i := 0; i < channels; i++ {
+					peak = max(peak, float32(math.Abs(float64(stack[l-1-i]))))
+				}
+				r.buffer[t] = 1 - params[0]/max(peak, params[0]) // the gain reduction needed by the incoming sample
+				// the gain reduction needed k samples ago is faded in linearly,
+				// reaching the full reduction when that sample is output
+				var reduction float32
+				for k := 1; k <= length; k++ {
+					reduction = max(reduction, r.buffer[t-uint16(k)]*float32(k))
+				}
+				reduction = max(unit.state[0]*(1-nonLinearMap(params[1])*rate), reduction/float32(length))
+				unit.state[0] = reduction
+				for i := 0; i < channels; i++ {
+					var d *delayline
+					d, delaylines = &delaylines[0], delaylines[1:]
+					d.buffer[t] = stack[l-1-i]
+					stack[l-1-i] = d.buffer[t-uint16(length)] * (1 - reduction)
+				}
 			case opCompressor:
+				var sidechain byte
+				sidechain, operands = operands[0], operands[1:]
 				signalLevel := stack[l-1] * stack[l-1] // square the signal to get power
 				if stereo {
 					signalLevel += stack[l-2] * stack[l-2]
@@ -585,25 +967,47 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 				if signalLevel < currentLevel {
 					paramIndex = 1 // compressor releasing
 				}
-				alpha := nonLinearMap(params[paramIndex]) // map attack or release to a smoothing coefficient
+				alpha := nonLinearMap(params[paramIndex]) * rate // map attack or release to a smoothing coefficient
 				currentLevel += (signalLevel - currentLevel) * alpha
 				unit.state[0] = currentLevel
 				var gain float32 = 1
 				if threshold2 := params[3] * params[3]; currentLevel > threshold2 {
 					gain = float32(math.Pow(float64(threshold2/currentLevel), float64(params[4]/2)))
 				}
-				gain /= params[2] // apply inverse gain
+				gain /= params[2]   // apply inverse gain
+				if sidechain == 1 { // the key signal is replaced with the gain
+					stack = stack[:l-channels]
+				}
 				stack = append(stack, gain)
 				if stereo {
 					stack = append(stack, gain)
 				}
+			case opFollower:
+				for i := 0; i < channels; i++ {
+					signalLevel := float32(math.Abs(float64(stack[l-1-i])))
+					currentLevel := unit.state[i*4]
+					paramIndex := 0 // follower attacking
+					if signalLevel < currentLevel {
+						paramIndex = 1 // follower releasing
+					}
+					currentLevel += (signalLevel - currentLevel) * nonLinearMap(params[paramIndex]) * rate
+					unit.state[i*4] = currentLevel
+					stack[l-1-i] = currentLevel
+				}
+			case opSlew:
+				for i := 0; i < channels; i++ {
+					delta := stack[l-1-i] - unit.state[i*4]
+					delta = max(min(delta, nonLinearMap(params[0])*rate), -nonLinearMap(params[1])*rate)
+					unit.state[i*4] += delta
+					stack[l-1-i] = unit.state[i*4]
+				}
 			case opBelleq:
 				// Bell-shaped peaking filter equations based on https://shepazu.github.io/Audio-EQ-Cookbook/audio-eq-cookbook.html:
 				//   alpha = sin(omega0)/(2*Q) where omega0 determines the angular frequency of the peak and Q is the Q-factor
 				//   A = sqrt(10^(dBgain/20)) = 10^(dBgain/40) where dbGain determines the gain at the peak
 				//   b0 = 1 + alpha*A, b1 = -2*cos(omega0), b2 = 1 - alpha*A,
 				//   a0 = 1 + alpha/A, a1 = -2*cos(omega0), a2 = 1 - alpha/A are the biquad filter coefficients
-				omega0 := 2 * params[0] * params[0]                                // square the omega to have a bit more values mapping to bass frequencies
+				omega0 := 2 * params[0] * params[0] * rate                         // square the omega to have a bit more values mapping to bass frequencies
 				alpha := float32(math.Sin(float64(omega0))) * 2 * params[1]        // Q=1/(4*(p/128)) gives a range of Q = 0.25 ... 32
 				A := float32(math.Pow(2, float64(params[2]-.5)*6.643856189774724)) // +-40 dB, reusing same constant as dbgain unit
 				u, v := alpha*A, alpha/A
@@ -636,6 +1040,7 @@ func (s *GoSynth) Render(buffer sointu.AudioBuffer, maxtime int) (samples int, r
 		samples++
 		renderTime++
 		s.state.globalTime++
+		s.state.songTime++
 	}
 	s.stack = stack[:0]
 	return samples, renderTime, nil
@@ -646,6 +1051,60 @@ func (s *synthState) rand() float32 {
 	return float32(int32(s.randSeed)) / -2147483648.0
 }
 
+// oversampledPole adjusts the pole p of a one-pole filter for an oversampled
+// voice, so that the cutoff stays approximately the same
+func oversampledPole(p, rate float32) float32 {
+	if rate == 1 {
+		return p
+	}
+	return 1 - (1-p)*rate
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float32
+}
+
+// decimationFilters are the lowpass filters applied to the output of an
+// oversampled voice before decimation: fourth order Butterworth filters, made
+// of two biquads, with the cutoff at 0.45 times the output sample rate. Indexed
+// by the oversampling factor.
+var decimationFilters = func() (ret [MAX_OVERSAMPLING + 1][2]biquad) {
+	for factor := 2; factor <= MAX_OVERSAMPLING; factor++ {
+		w := 2 * math.Pi * 0.45 / float64(factor)
+		for i, q := range []float64{0.54119610, 1.3065630} {
+			alpha := math.Sin(w) / (2 * q)
+			a0 := 1 + alpha
+			b1 := (1 - math.Cos(w)) / a0
+			ret[factor][i] = biquad{float32(b1 / 2), float32(b1), float32(b1 / 2), float32(-2 * math.Cos(w) / a0), float32((1 - alpha) / a0)}
+		}
+	}
+	return
+}()
+
+// decimate filters the signals going out of an oversampled voice with the
+// decimation filter, using four floats of state per signal. Returns true on
+// the last iteration of the voice, when the signals should be output.
+func decimate(signals []float32, state []float32, factor, sub int) bool {
+	for i := range signals {
+		for j, f := range decimationFilters[factor] {
+			st := state[i*4+j*2 : i*4+j*2+2]
+			x := signals[i]
+			y := f.b0*x + st[0] // biquad in transposed direct form II
+			st[0] = f.b1*x - f.a1*y + st[1]
+			st[1] = f.b2*x - f.a2*y
+			signals[i] = y
+		}
+	}
+	return sub == factor-1
+}
+
+// envelopeCurve returns the factor by which an envelope segment is sped up,
+// when distance is the remaining distance to the end of the segment. The curve
+// operand is the curve parameter offset by 64.
+func envelopeCurve(curve byte, distance, span float32) float32 {
+	return 1 + sointu.EnvelopeCurve(int(curve)-64)*(2*distance/(span+sointu.EnvelopeSpanEpsilon)-1)
+}
+
 func nonLinearMap(value float32) float32 {
 	return float32(math.Exp2(float64(-24 * value)))
 }
@@ -665,6 +1124,35 @@ func crush(value, amount float32) float32 {
 	return float32(math.Round(float64(value/n)) * float64(n))
 }
 
+// mathFunction applies the function of the math unit to value; flags has the
+// bit 1<<function set
+func mathFunction(value float32, flags byte) float32 {
+	switch {
+	case flags&(1<<sointu.MathAbs) != 0:
+		return float32(math.Abs(float64(value)))
+	case flags&(1<<sointu.MathSign) != 0:
+		if value > 0 {
+			return 1
+		}
+		if value < 0 {
+			return -1
+		}
+	case flags&(1<<sointu.MathTanh) != 0:
+		return float32(math.Tanh(float64(value)))
+	case flags&(1<<sointu.MathSquare) != 0:
+		return value * value
+	case flags&(1<<sointu.MathSqrt) != 0:
+		return float32(math.Sqrt(math.Abs(float64(value))))
+	}
+	return value
+}
+
+// ladderSaturate is a cubic soft clipper, x-4/27*x^3 in the range [-1.5,1.5]
+func ladderSaturate(x float64) float64 {
+	c := math.Max(math.Min(x*0.6666667, 1), -1)
+	return c * (1.5 - 0.5*c*c)
+}
+
 func waveshape(value, amount float32) float32 {
 	absVal := value
 	if absVal < 0 {
@@ -672,3 +1160,65 @@ func waveshape(value, amount float32) float32 {
 	}
 	return value * amount / (1 - amount + (2*amount-1)*absVal)
 }
+
+func trisaw(phase, color float64) float64 {
+	if phase >= color { // since phase cannot be 1, if color = 1, then this condition never fires
+		phase = 1 - phase
+		color = 1 - color
+	}
+	return phase/color*2 - 1
+}
+
+func pulse(phase, color float64) float64 {
+	if phase >= color {
+		return -1
+	}
+	return 1
+}
+
+// trisawAA is the trisaw with the corners smoothed using polyBLAMP. The color
+// is limited so that both slopes are at least one sample long.
+func trisawAA(phase, color, dt float64) float64 {
+	color = math.Min(math.Max(color, dt), 1-dt)
+	u0 := math.Abs(blepDistance(phase, dt))
+	uc := math.Abs(blepDistance(phase-color, dt))
+	// the slope changes by 2/(color*(1-color)) at the corners and the
+	// integrated polyBLEP residual is u^3/6
+	return trisaw(phase, color) + (u0*u0*u0-uc*uc*uc)*dt/(3*color*(1-color))
+}
+
+// pulseAA is the pulse with the edges smoothed using polyBLEP.
+func pulseAA(phase, color, dt float64) float64 {
+	u0 := blepDistance(phase, dt)
+	uc := blepDistance(phase-color, dt)
+	// the polyBLEP residual of a step of height 2 is u^2
+	return pulse(phase, color) - u0*math.Abs(u0) + uc*math.Abs(uc)
+}
+
+// blepDistance returns 1-|x|/dt, where x is the distance of the phase from a
+// discontinuity, wrapped to [-0.5,0.5]. The result has the sign of x and is
+// 0 when the phase is more than dt away from the discontinuity.
+func blepDistance(x, dt float64) float64 {
+	x -= math.RoundToEven(x)
+	u := math.Max(1-math.Abs(x)/dt, 0)
+	if x < 0 {
+		return -u
+	}
+	return u
+}
+
+// wavetableSplit splits x into integer and fractional parts. The integer part
+// is computed by rounding x-0.5 to nearest even, as the x87 FPU does, so at
+// integers the fractional part can be 1; the interpolation does not care.
+func wavetableSplit(x float64) (int, float64) {
+	i := math.RoundToEven(x - 0.5)
+	return int(i), x - i
+}
+
+// wavetableLerp interpolates linearly between the samples i and i+1 of the
+// frame, the last sample wrapping around to the first.
+func wavetableLerp(frame []uint16, length, i int, f float64) float64 {
+	s0 := float64(int16(frame[i%length]))
+	s1 := float64(int16(frame[(i+1)%length]))
+	return s0 + (s1-s0)*f
+}
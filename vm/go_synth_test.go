@@ -76,9 +76,13 @@ func TestAllRegressionTests(t *testing.T) {
 }
 
 var defaultUnits = map[string]sointu.Unit{
-	"envelope":   {Type: "envelope", Parameters: map[string]int{"stereo": 0, "attack": 64, "decay": 64, "sustain": 64, "release": 64, "gain": 64}},
+	"envelope":   {Type: "envelope", Parameters: map[string]int{"stereo": 0, "attack": 64, "attackcurve": 0, "decay": 64, "decaycurve": 0, "sustain": 64, "release": 64, "releasecurve": 0, "gain": 64}},
 	"oscillator": {Type: "oscillator", Parameters: map[string]int{"stereo": 0, "transpose": 64, "detune": 64, "phase": 0, "color": 64, "shape": 64, "gain": 64, "type": sointu.Sine}},
+	"math":       {Type: "math", Parameters: map[string]int{"stereo": 0, "function": 0}},
+	"midside":    {Type: "midside", Parameters: map[string]int{"mode": 0, "width": 64}},
 	"noise":      {Type: "noise", Parameters: map[string]int{"stereo": 0, "shape": 64, "gain": 64}},
+	"ramp":       {Type: "ramp", Parameters: map[string]int{"stereo": 0, "length": 4, "division": 1, "phase": 0, "gain": 128}},
+	"random":     {Type: "random", Parameters: map[string]int{"stereo": 0, "rate": 64, "sync": 0, "smooth": 0, "gain": 64}},
 	"mulp":       {Type: "mulp", Parameters: map[string]int{"stereo": 0}},
 	"mul":        {Type: "mul", Parameters: map[string]int{"stereo": 0}},
 	"add":        {Type: "add", Parameters: map[string]int{"stereo": 0}},
@@ -98,18 +102,31 @@ var defaultUnits = map[string]sointu.Unit{
 	"hold":       {Type: "hold", Parameters: map[string]int{"stereo": 0, "holdfreq": 64}},
 	"distort":    {Type: "distort", Parameters: map[string]int{"stereo": 0, "drive": 64}},
 	"filter":     {Type: "filter", Parameters: map[string]int{"stereo": 0, "frequency": 64, "resonance": 64, "lowpass": 1, "bandpass": 0, "highpass": 0}},
+	"formant":    {Type: "formant", Parameters: map[string]int{"stereo": 0, "vowel": 0, "resonance": 16}},
+	"ladder":     {Type: "ladder", Parameters: map[string]int{"stereo": 0, "frequency": 64, "resonance": 32, "drive": 0}},
+	"phaser":     {Type: "phaser", Parameters: map[string]int{"stereo": 0, "stages": 4, "frequency": 64, "feedback": 64, "dry": 128}},
 	"out":        {Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 64}},
 	"outaux":     {Type: "outaux", Parameters: map[string]int{"stereo": 1, "outgain": 64, "auxgain": 64}},
 	"aux":        {Type: "aux", Parameters: map[string]int{"stereo": 1, "gain": 64, "channel": 2}},
 	"delay": {Type: "delay",
-		Parameters: map[string]int{"damp": 0, "dry": 128, "feedback": 96, "notetracking": 2, "pregain": 40, "stereo": 0},
+		Parameters: map[string]int{"damp": 0, "dry": 128, "feedback": 96, "notetracking": 2, "pingpong": 0, "pregain": 40, "spread": 128, "stereo": 0},
 		VarArgs:    []int{48}},
+	"pluck":      {Type: "pluck", Parameters: map[string]int{"stereo": 0, "transpose": 64, "detune": 64, "decay": 112, "damp": 32}},
+	"chorus":     {Type: "chorus", Parameters: map[string]int{"stereo": 0, "rate": 24, "depth": 32, "delay": 96, "feedback": 64, "spread": 64, "wet": 96}},
+	"reverb":     {Type: "reverb", Parameters: map[string]int{"stereo": 0, "size": 64, "predelay": 0, "decay": 96, "damping": 64, "modulation": 32, "dry": 128, "wet": 64}},
 	"in":         {Type: "in", Parameters: map[string]int{"stereo": 1, "channel": 2}},
+	"slew":       {Type: "slew", Parameters: map[string]int{"stereo": 0, "rise": 64, "fall": 64}},
 	"speed":      {Type: "speed", Parameters: map[string]int{}},
-	"compressor": {Type: "compressor", Parameters: map[string]int{"stereo": 0, "attack": 64, "release": 64, "invgain": 64, "threshold": 64, "ratio": 64}},
+	"compressor": {Type: "compressor", Parameters: map[string]int{"stereo": 0, "attack": 64, "release": 64, "invgain": 64, "threshold": 64, "ratio": 64, "sidechain": 0}},
+	"follower":   {Type: "follower", Parameters: map[string]int{"stereo": 0, "attack": 32, "release": 64}},
+	"limiter":    {Type: "limiter", Parameters: map[string]int{"stereo": 0, "ceiling": 120, "release": 64, "lookahead": 64}},
 	"send":       {Type: "send", Parameters: map[string]int{"stereo": 0, "amount": 128, "voice": 0, "unit": 0, "port": 0, "sendpop": 1}},
 	"sync":       {Type: "sync", Parameters: map[string]int{}},
 	"belleq":     {Type: "belleq", Parameters: map[string]int{"stereo": 0, "freq": 64, "bandwidth": 64, "gain": 96}},
+	"operator":   {Type: "operator", Parameters: map[string]int{"stereo": 0, "coarse": 1, "fine": 0, "fixed": 0, "feedback": 0, "gain": 64}},
+	"wavetable": {Type: "wavetable",
+		Parameters: map[string]int{"stereo": 0, "transpose": 64, "detune": 64, "position": 0, "gain": 64, "frames": 1},
+		VarArgs:    []int{0, 64, 0, -64}},
 }
 
 var defaultInstrument = sointu.Instrument{
@@ -206,6 +223,33 @@ func TestStackUnderflow(t *testing.T) {
 	}
 }
 
+func TestWavetableSampleRange(t *testing.T) {
+	for _, sample := range []int{-129, 128} {
+		patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+			{Type: "wavetable", Parameters: map[string]int{"stereo": 0, "transpose": 64, "detune": 64, "position": 0, "gain": 64, "frames": 1}, VarArgs: []int{0, sample}},
+			{Type: "out", Parameters: map[string]int{"stereo": 0, "gain": 64}},
+		}}}
+		if _, err := (vm.GoSynther{}).Synth(patch, 120); err == nil {
+			t.Fatalf("expected the wavetable sample %v to be rejected", sample)
+		}
+	}
+}
+
+func TestFormantDelayTimes(t *testing.T) {
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+		{Type: "loadval", Parameters: map[string]int{"stereo": 0, "value": 64}},
+		{Type: "formant", Parameters: map[string]int{"stereo": 0, "vowel": 64, "resonance": 16}},
+		{Type: "out", Parameters: map[string]int{"stereo": 0, "gain": 64}},
+	}}}
+	bytecode, err := vm.NewBytecode(patch, vm.NecessaryFeaturesFor(patch), 120)
+	if err != nil {
+		t.Fatalf("could not encode the patch: %v", err)
+	}
+	if len(bytecode.DelayTimes) > 0 {
+		t.Errorf("the formant unit should not use the delay times, got %v", bytecode.DelayTimes)
+	}
+}
+
 func TestStackBalancing(t *testing.T) {
 	patch := sointu.Patch{
 		sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
@@ -223,6 +267,134 @@ func TestStackBalancing(t *testing.T) {
 	}
 }
 
+func TestLimiterCeiling(t *testing.T) {
+	patch := sointu.Patch{
+		sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+			{Type: "noise", Parameters: map[string]int{"stereo": 1, "shape": 64, "gain": 128}},
+			{Type: "invgain", Parameters: map[string]int{"stereo": 1, "invgain": 8}},
+			{Type: "limiter", Parameters: map[string]int{"stereo": 1, "ceiling": 64, "release": 32, "lookahead": 8}},
+			{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+		}}}
+	synth, err := vm.GoSynther{}.Synth(patch, 120)
+	if err != nil {
+		t.Fatalf("bridge compile error: %v", err)
+	}
+	defer synth.Close()
+	buffer := make(sointu.AudioBuffer, 10000)
+	if err = buffer.Fill(synth); err != nil {
+		t.Fatalf("rendering failed: %v", err)
+	}
+	const ceiling = 0.5 + 1e-5 // allow for rounding errors
+	for i, v := range buffer {
+		if math.Abs(float64(v[0])) > ceiling || math.Abs(float64(v[1])) > ceiling {
+			t.Fatalf("sample %v exceeded the ceiling of the limiter: %v", i, v)
+		}
+	}
+}
+
+func TestEnvelopeCurveSpeed(t *testing.T) {
+	render := func(sustain, curve int) sointu.AudioBuffer {
+		patch := sointu.Patch{
+			sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+				{Type: "envelope", Parameters: map[string]int{"stereo": 0, "attack": 0, "decay": 80, "decaycurve": curve, "sustain": sustain, "release": 80, "releasecurve": curve, "gain": 128}},
+				{Type: "out", Parameters: map[string]int{"stereo": 0, "gain": 128}},
+			}}}
+		synth, err := vm.GoSynther{}.Synth(patch, 120)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		defer synth.Close()
+		synth.Trigger(0, 64)
+		buffer := make(sointu.AudioBuffer, 20000)
+		if err = buffer[:10000].Fill(synth); err != nil {
+			t.Fatalf("rendering failed: %v", err)
+		}
+		synth.Release(0)
+		if err = buffer[10000:].Fill(synth); err != nil {
+			t.Fatalf("rendering failed: %v", err)
+		}
+		return buffer
+	}
+	// a positive curve should start faster than a linear segment, and a
+	// negative curve slower, regardless of the sustain level
+	for _, sustain := range []int{16, 64, 112} {
+		linear, fast, slow := render(sustain, 0), render(sustain, 48), render(sustain, -48)
+		for _, i := range []int{100, 10100} { // early in the decay and in the release
+			if !(fast[i][0] < linear[i][0] && linear[i][0] < slow[i][0]) {
+				t.Fatalf("sustain %v, sample %v: expected positive curve < linear < negative curve, got %v, %v, %v", sustain, i, fast[i][0], linear[i][0], slow[i][0])
+			}
+		}
+	}
+}
+
+func TestOversampling(t *testing.T) {
+	render := func(factor int) sointu.AudioBuffer {
+		patch := sointu.Patch{
+			sointu.Instrument{NumVoices: 1, Oversampling: factor, Units: []sointu.Unit{
+				{Type: "envelope", Parameters: map[string]int{"stereo": 0, "attack": 32, "decay": 32, "sustain": 64, "release": 64, "gain": 128}},
+				{Type: "oscillator", Parameters: map[string]int{"stereo": 0, "transpose": 64, "detune": 64, "phase": 0, "color": 128, "shape": 64, "gain": 128, "type": sointu.Sine}},
+				{Type: "mulp", Parameters: map[string]int{"stereo": 0}},
+				{Type: "pan", Parameters: map[string]int{"stereo": 0, "panning": 64}},
+				{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+			}}}
+		synth, err := vm.GoSynther{}.Synth(patch, 120)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		defer synth.Close()
+		synth.Trigger(0, 48)
+		buffer := make(sointu.AudioBuffer, 10000)
+		if err = buffer.Fill(synth); err != nil {
+			t.Fatalf("rendering failed: %v", err)
+		}
+		return buffer
+	}
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Oversampling: 3, Units: []sointu.Unit{
+		{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+	}}}
+	if _, err := (vm.GoSynther{}).Synth(patch, 120); err == nil {
+		t.Fatalf("expected 3x oversampling to be rejected")
+	}
+	expected := render(1)
+	for _, factor := range []int{2, 4} {
+		buffer := render(factor)
+		// a band-limited signal should sound the same regardless of the
+		// oversampling, apart from the small delay of the decimation filter
+		for i, v := range expected[1 : len(expected)-1] {
+			if d := math.Min(math.Abs(float64(v[0]-buffer[i+1][0])), math.Abs(float64(v[0]-buffer[i+2][0]))); d > 2e-3 {
+				t.Fatalf("oversampling %v: sample %v differs by %v", factor, i+1, d)
+			}
+		}
+	}
+}
+
+func TestAutomationLane(t *testing.T) {
+	patch := sointu.Patch{sointu.Instrument{NumVoices: 1, Units: []sointu.Unit{
+		{Type: "loadval", ID: 1, Parameters: map[string]int{"stereo": 1, "value": 64}},
+		{Type: "out", Parameters: map[string]int{"stereo": 1, "gain": 128}},
+	}}}
+	lane := []byte{0, 96, 1, 32, 0, 1, 255, 1}
+	song := sointu.Song{BPM: 100, RowsPerBeat: 4, Patch: patch, Score: sointu.Score{RowsPerPattern: 8, Length: 1, Tracks: []sointu.Track{
+		{NumVoices: 1, Order: sointu.Order{0}, Patterns: []sointu.Pattern{{64, 1, 1, 1, 1, 1, 1, 1}}},
+		{Automation: sointu.AutomationTarget{UnitID: 1, Port: 0}, Order: sointu.Order{0}, Patterns: []sointu.Pattern{lane}},
+	}}}
+	buffer, err := sointu.Play(vm.GoSynther{}, song, nil)
+	if err != nil {
+		t.Fatalf("Play failed: %v", err)
+	}
+	// the lane sets the value at the start of each row, holds keep the
+	// previous value, note offs return to the patch value and values above
+	// the maximum are clamped
+	expected := []float32{64, 96, 96, 32, 64, 64, 128, 128}
+	for row, v := range expected {
+		for _, i := range []int{row * song.SamplesPerRow(), (row+1)*song.SamplesPerRow() - 1} {
+			if d := math.Abs(float64(buffer[i][0] - (v/64 - 1))); d > 1e-6 {
+				t.Fatalf("row %v, sample %v: expected %v, got %v", row, i, v/64-1, buffer[i][0])
+			}
+		}
+	}
+}
+
 func compareToRawFloat32(t *testing.T, buffer sointu.AudioBuffer, rawname string) {
 	_, filename, _, _ := runtime.Caller(0)
 	expectedb, err := ioutil.ReadFile(path.Join(path.Dir(filename), "..", "tests", "expected_output", rawname))
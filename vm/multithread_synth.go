@@ -48,6 +48,7 @@ func MakeMultithreadSynther(synther sointu.Synther) MultithreadSynther {
 
 func (s MultithreadSynther) Name() string                 { return s.name }
 func (s MultithreadSynther) SupportsMultithreading() bool { return true }
+func (s MultithreadSynther) SupportsOversampling() bool   { return s.synther.SupportsOversampling() }
 
 func (s MultithreadSynther) Synth(patch sointu.Patch, bpm int) (sointu.Synth, error) {
 	patches, voiceMapping := splitPatchByCores(patch)
@@ -139,6 +140,18 @@ func (s *MultithreadSynth) Release(voiceIndex int) {
 	}
 }
 
+func (s *MultithreadSynth) SetParameter(target sointu.AutomationTarget, value int) {
+	for _, synth := range s.synths {
+		synth.SetParameter(target, value) // the synths without the targeted unit ignore it
+	}
+}
+
+func (s *MultithreadSynth) SetSongTime(time int) {
+	for _, synth := range s.synths {
+		synth.SetSongTime(time)
+	}
+}
+
 func (s *MultithreadSynth) CPULoad(loads []sointu.CPULoad) (elems int) {
 	for _, synth := range s.synths {
 		n := synth.CPULoad(loads)
@@ -6,34 +6,49 @@ const (
 	opAddp       = 2
 	opAux        = 3
 	opBelleq     = 4
-	opClip       = 5
-	opCompressor = 6
-	opCrush      = 7
-	opDbgain     = 8
-	opDelay      = 9
-	opDistort    = 10
-	opEnvelope   = 11
-	opFilter     = 12
-	opGain       = 13
-	opHold       = 14
-	opIn         = 15
-	opInvgain    = 16
-	opLoadnote   = 17
-	opLoadval    = 18
-	opMul        = 19
-	opMulp       = 20
-	opNoise      = 21
-	opOscillator = 22
-	opOut        = 23
-	opOutaux     = 24
-	opPan        = 25
-	opPop        = 26
-	opPush       = 27
-	opReceive    = 28
-	opSend       = 29
-	opSpeed      = 30
-	opSync       = 31
-	opXch        = 32
+	opChorus     = 5
+	opClip       = 6
+	opCompressor = 7
+	opCrush      = 8
+	opDbgain     = 9
+	opDelay      = 10
+	opDistort    = 11
+	opEnvelope   = 12
+	opFilter     = 13
+	opFollower   = 14
+	opFormant    = 15
+	opGain       = 16
+	opHold       = 17
+	opIn         = 18
+	opInvgain    = 19
+	opLadder     = 20
+	opLimiter    = 21
+	opLoadnote   = 22
+	opLoadval    = 23
+	opMath       = 24
+	opMidside    = 25
+	opMul        = 26
+	opMulp       = 27
+	opNoise      = 28
+	opOperator   = 29
+	opOscillator = 30
+	opOut        = 31
+	opOutaux     = 32
+	opPan        = 33
+	opPhaser     = 34
+	opPluck      = 35
+	opPop        = 36
+	opPush       = 37
+	opRamp       = 38
+	opRandom     = 39
+	opReceive    = 40
+	opReverb     = 41
+	opSend       = 42
+	opSlew       = 43
+	opSpeed      = 44
+	opSync       = 45
+	opWavetable  = 46
+	opXch        = 47
 )
 
-var transformCounts = [...]int{0, 0, 1, 3, 0, 5, 1, 1, 4, 1, 5, 2, 1, 1, 0, 1, 0, 1, 0, 0, 2, 6, 1, 2, 1, 0, 0, 0, 1, 0, 0, 0}
+var transformCounts = [...]int{0, 0, 1, 3, 6, 0, 5, 1, 1, 4, 1, 5, 2, 2, 2, 1, 1, 0, 1, 3, 2, 0, 1, 0, 1, 0, 0, 2, 3, 6, 1, 2, 1, 3, 4, 0, 0, 2, 2, 0, 5, 1, 2, 0, 0, 4, 0}